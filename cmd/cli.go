@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"peak/tasks"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+const usage = `Usage: peak <command> [flags]
+
+Commands:
+  menu          Show the interactive menu (default)
+  run           Run every task in the tasks file
+  validate      Validate the tasks, config and sites files
+  watch         Post restock and new product events without checking out
+  test-proxies  Test the configured proxies
+  sites list    List the configured sites
+  history       Query and export the checkout history database
+  import        Move card details from the tasks and profiles files into the vault
+
+Flags:
+`
+
+var (
+	logOptions  = tasks.DefaultLogOptions()
+	plainOutput bool
+	dryRun      bool
+)
+
+func Execute(args []string) int {
+	defer tasks.CloseLogs()
+
+	if len(args) == 0 {
+		return runMenu(nil)
+	}
+
+	command, rest := args[0], args[1:]
+	switch command {
+	case "menu":
+		return runMenu(rest)
+	case "run":
+		return runTasks(rest)
+	case "validate":
+		return validateTasks(rest)
+	case "watch":
+		return watchSites(rest)
+	case "test-proxies":
+		return testProxies(rest)
+	case "history":
+		return history(rest)
+	case "import":
+		return importSecrets(rest)
+	case "sites":
+		if len(rest) == 0 || rest[0] != "list" {
+			fmt.Fprintln(os.Stderr, "Usage: peak sites list [flags]")
+			return ExitUsage
+		}
+		return listSites(rest[1:])
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return ExitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", command)
+		printUsage(os.Stderr)
+		return ExitUsage
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, usage)
+	fs, _ := newFlagSet("peak")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *tasks.Files) {
+	files := tasks.DefaultFiles()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&files.Tasks, "tasks", files.Tasks, "path to the tasks CSV file")
+	fs.StringVar(&files.Config, "config", files.Config, "path to the config JSON file")
+	fs.StringVar(&files.Sites, "sites", files.Sites, "path to the sites JSON file")
+	fs.StringVar(&files.Proxies, "proxies", files.Proxies, "path to the proxies file")
+	fs.StringVar(&files.Profiles, "profiles", files.Profiles, "path to the profiles JSON or CSV file")
+	fs.StringVar(&files.Vault, "vault", files.Vault, "path to the encrypted card vault")
+	fs.StringVar(&files.History, "history", files.History, "path to the history SQLite database")
+
+	logOptions = tasks.DefaultLogOptions()
+	fs.TextVar(&logOptions.Level, "log-level", logOptions.Level, "minimum log level: debug, info, warn or error")
+	fs.StringVar(&logOptions.Format, "log-format", logOptions.Format, "log output format: console or json")
+	fs.StringVar(&logOptions.Dir, "log-dir", logOptions.Dir, "directory for per-task log files, empty to disable")
+	fs.BoolVar(&plainOutput, "plain", false, "print plain logs instead of the live task dashboard")
+	fs.BoolVar(&dryRun, "dry-run", false, "run every task up to order placement and log the order instead of placing it")
+	return fs, &files
+}
+
+func parseArgs(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := tasks.SetupLogging(logOptions); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	tasks.SetDryRun(dryRun)
+	return nil
+}
+
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func parseFlags(name string, args []string) (*tasks.Files, bool) {
+	fs, files := newFlagSet(name)
+	if err := parseArgs(fs, args); err != nil {
+		return nil, false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", fs.Args())
+		return nil, false
+	}
+	return files, true
+}
+
+func runMenu(args []string) int {
+	files, ok := parseFlags("menu", args)
+	if !ok {
+		return ExitUsage
+	}
+	if err := unlockVault(*files); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	ShowMenu(*files)
+	return ExitOK
+}
+
+func runTasks(args []string) int {
+	files, ok := parseFlags("run", args)
+	if !ok {
+		return ExitUsage
+	}
+
+	if err := unlockVault(*files); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	checkouts, err := runTasksInteractive(ctx, stop, *files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	if checkouts == 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+func validateTasks(args []string) int {
+	files, ok := parseFlags("validate", args)
+	if !ok {
+		return ExitUsage
+	}
+	if err := unlockVault(*files); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+
+	validated, err := tasks.PrepareTasks(*files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	fmt.Printf("%d tasks OK\n", len(validated))
+
+	noted := make(map[int]bool)
+	for _, task := range validated {
+		if task.Query == nil || !task.Query.ImplicitAnd() || noted[task.Row] {
+			continue
+		}
+		noted[task.Row] = true
+		fmt.Printf("Note: row %d keyword %q matches names containing every word in any order, wrap words in quotes to match them as one phrase\n", task.Row, task.Keyword)
+	}
+	return ExitOK
+}
+
+func watchSites(args []string) int {
+	fs, files := newFlagSet("watch")
+	siteList := fs.String("site", "", "comma separated sites to watch (default all)")
+	delay := fs.Duration("delay", 5*time.Second, "delay between polls")
+	if err := parseArgs(fs, args); err != nil {
+		return ExitUsage
+	}
+
+	var siteNames []string
+	if *siteList != "" {
+		siteNames = strings.Split(*siteList, ",")
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if err := tasks.WatchSites(ctx, *files, siteNames, *delay); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+func testProxies(args []string) int {
+	fs, files := newFlagSet("test-proxies")
+	group := fs.String("group", "", "only test proxies in this group")
+	target := fs.String("target", "", "URL to request through each proxy (default from config)")
+	if err := parseArgs(fs, args); err != nil {
+		return ExitUsage
+	}
+
+	failures, err := tasks.TestProxies(*files, *group, *target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	if failures > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+func listSites(args []string) int {
+	files, ok := parseFlags("sites list", args)
+	if !ok {
+		return ExitUsage
+	}
+
+	if err := tasks.LoadSites(files.Sites); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SITE\tLINK\tPRODUCT LINK\tPAYMENT")
+	for _, site := range tasks.ListSites() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\n", site.Site, site.Link, site.ProductLink, site.PaymentCategory, site.GatewayHandle)
+	}
+	w.Flush()
+	return ExitOK
+}
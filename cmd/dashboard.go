@@ -0,0 +1,494 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"peak/tasks"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	screenEnter = "\033[?1049h\033[?25l"
+	screenLeave = "\033[?25h\033[?1049l"
+	screenHome  = "\033[H"
+	clearLine   = "\033[K"
+	clearBelow  = "\033[J"
+	styleReset  = "\033[0m"
+	styleBold   = "\033[1m"
+	styleDim    = "\033[90m"
+	styleInvert = "\033[7m"
+	styleRed    = "\033[31m"
+	styleGreen  = "\033[32m"
+	styleYellow = "\033[33m"
+	styleCyan   = "\033[36m"
+)
+
+const minLinkWidth = 24
+
+var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+type logTail struct {
+	mu      sync.Mutex
+	lines   []string
+	partial string
+	max     int
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	text := t.partial + ansiRegex.ReplaceAllString(string(p), "")
+	lines := strings.Split(text, "\n")
+	t.partial = lines[len(lines)-1]
+	t.lines = append(t.lines, lines[:len(lines)-1]...)
+	if len(t.lines) > t.max {
+		t.lines = append([]string(nil), t.lines[len(t.lines)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+func (t *logTail) last(n int) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n > len(t.lines) {
+		n = len(t.lines)
+	}
+	return append([]string(nil), t.lines[len(t.lines)-n:]...)
+}
+
+type runResult struct {
+	checkouts int
+	err       error
+}
+
+type dashboard struct {
+	tty         *os.File
+	state       *term.State
+	out         *bufio.Writer
+	logs        *logTail
+	restoreLogs func()
+	stop        context.CancelFunc
+	selected    int
+	offset      int
+	showLinks   bool
+	message     string
+	stopping    bool
+	finished    bool
+}
+
+func dashboardAvailable() bool {
+	return !plainOutput && logOptions.Format == tasks.LogFormatConsole && term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("TERM") != "dumb"
+}
+
+func runTasksInteractive(ctx context.Context, stop context.CancelFunc, files tasks.Files) (int, error) {
+	if !dashboardAvailable() {
+		return tasks.RunTasks(ctx, files)
+	}
+
+	d, err := openDashboard(stop)
+	if err != nil {
+		return tasks.RunTasks(ctx, files)
+	}
+
+	results := make(chan runResult, 1)
+	go func() {
+		checkouts, err := tasks.RunTasks(ctx, files)
+		results <- runResult{checkouts: checkouts, err: err}
+	}()
+
+	result := d.run(results)
+	d.close()
+
+	if result.err == nil {
+		printCheckoutLinks(tasks.CheckoutLinks())
+		for _, line := range d.logs.last(2) {
+			fmt.Println(line)
+		}
+	}
+	return result.checkouts, result.err
+}
+
+func openDashboard(stop context.CancelFunc) (*dashboard, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var state *term.State
+	conn, err := tty.SyscallConn()
+	if err == nil {
+		if controlErr := conn.Control(func(fd uintptr) {
+			state, err = term.MakeRaw(int(fd))
+		}); controlErr != nil {
+			err = controlErr
+		}
+	}
+	if err != nil {
+		tty.Close()
+		return nil, err
+	}
+
+	d := &dashboard{tty: tty, state: state, out: bufio.NewWriter(os.Stdout), logs: &logTail{max: 500}, stop: stop}
+	d.restoreLogs = tasks.SetLogOutput(d.logs)
+	d.out.WriteString(screenEnter)
+	d.out.Flush()
+	return d, nil
+}
+
+func (d *dashboard) close() {
+	d.out.WriteString(screenLeave)
+	d.out.Flush()
+	d.restoreLogs()
+
+	if conn, err := d.tty.SyscallConn(); err == nil {
+		conn.Control(func(fd uintptr) {
+			term.Restore(int(fd), d.state)
+		})
+	}
+	d.tty.Close()
+}
+
+func (d *dashboard) readKeys(keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 16)
+	for {
+		n, err := d.tty.Read(buf)
+		if err != nil {
+			return
+		}
+		keys <- string(buf[:n])
+	}
+}
+
+func (d *dashboard) run(results <-chan runResult) runResult {
+	keys := make(chan string, 8)
+	go d.readKeys(keys)
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	var result runResult
+	for {
+		d.render()
+		select {
+		case <-ticker.C:
+		case result = <-results:
+			if result.err != nil {
+				return result
+			}
+			d.finished = true
+			d.message = fmt.Sprintf("Run finished with %d checkouts, press q to close", result.checkouts)
+			results = nil
+		case key, ok := <-keys:
+			if !ok {
+				keys = nil
+				continue
+			}
+			if strings.HasPrefix(key, "\x1b") {
+				if d.handleKey(key) {
+					return result
+				}
+				continue
+			}
+			for _, r := range key {
+				if d.handleKey(string(r)) {
+					return result
+				}
+			}
+		}
+	}
+}
+
+func (d *dashboard) handleKey(key string) bool {
+	statuses := tasks.TaskStatuses()
+	task := d.selected + 1
+
+	var err error
+	switch key {
+	case "q", "Q", "\x03":
+		if d.finished {
+			return true
+		}
+		if !d.stopping {
+			d.stopping = true
+			d.message = "Stopping tasks..."
+			d.stop()
+		}
+	case "\x1b[A", "k":
+		if d.selected > 0 {
+			d.selected--
+		}
+	case "\x1b[B", "j":
+		if d.selected < len(statuses)-1 {
+			d.selected++
+		}
+	case "l", "L":
+		d.showLinks = !d.showLinks
+	case "s", "S":
+		if err = tasks.StopTask(task); err == nil {
+			d.message = fmt.Sprintf("Stopped task %d", task)
+		}
+	case "r", "R":
+		if err = tasks.RestartTask(task); err == nil {
+			d.message = fmt.Sprintf("Restarting task %d", task)
+		}
+	case "p", "P", " ":
+		if d.selected >= len(statuses) {
+			return false
+		}
+		if statuses[d.selected].Paused {
+			if err = tasks.ResumeTask(task); err == nil {
+				d.message = fmt.Sprintf("Resumed task %d", task)
+			}
+		} else if err = tasks.PauseTask(task); err == nil {
+			d.message = fmt.Sprintf("Paused task %d", task)
+		}
+	}
+	if err != nil {
+		d.message = err.Error()
+	}
+	return false
+}
+
+func (d *dashboard) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 40 || height < 10 {
+		width, height = 120, 40
+	}
+
+	statuses := tasks.TaskStatuses()
+	var lines []string
+	lines = append(lines, styleBold+fit(fmt.Sprintf("peak - %d tasks", len(statuses)), width)+styleReset)
+	lines = append(lines, styleDim+fit("up/down select  p pause/resume  s stop  r restart  l checkout links  q quit", width)+styleReset)
+	lines = append(lines, "")
+
+	logLines := height / 4
+	tableHeight := height - len(lines) - logLines - 4
+	if d.showLinks {
+		lines = append(lines, d.linkLines(width, tableHeight)...)
+	} else {
+		lines = append(lines, d.taskLines(statuses, width, tableHeight)...)
+	}
+
+	lines = append(lines, "")
+	lines = append(lines, fit(totals(statuses), width))
+	if d.message != "" {
+		lines = append(lines, styleYellow+fit(d.message, width)+styleReset)
+	} else {
+		lines = append(lines, "")
+	}
+	lines = append(lines, styleDim+strings.Repeat("-", width)+styleReset)
+	for _, line := range d.logs.last(height - len(lines)) {
+		lines = append(lines, styleDim+fit(line, width)+styleReset)
+	}
+
+	d.out.WriteString(screenHome)
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		d.out.WriteString(line)
+		d.out.WriteString(clearLine)
+		if i < height-1 && i < len(lines)-1 {
+			d.out.WriteString("\r\n")
+		}
+	}
+	d.out.WriteString(clearBelow)
+	d.out.Flush()
+}
+
+func (d *dashboard) taskLines(statuses []tasks.TaskStatus, width int, rows int) []string {
+	if rows < 1 {
+		rows = 1
+	}
+	if d.selected >= len(statuses) {
+		d.selected = len(statuses) - 1
+	}
+	if d.selected < 0 {
+		d.selected = 0
+	}
+	if d.selected < d.offset {
+		d.offset = d.selected
+	}
+	if d.selected >= d.offset+rows {
+		d.offset = d.selected - rows + 1
+	}
+
+	errWidth := width - 97
+	if errWidth < 10 {
+		errWidth = 10
+	}
+	format := "%-5s %-12s %-24s %-14s %-16s %7s %9s  %s"
+	lines := []string{styleBold + fit(fmt.Sprintf(format, "TASK", "SITE", "PRODUCT", "VARIANT", "STATE", "RETRIES", "ELAPSED", "LAST ERROR"), width) + styleReset}
+	if len(statuses) == 0 {
+		return append(lines, styleDim+"Loading tasks..."+styleReset)
+	}
+
+	for i := d.offset; i < len(statuses) && i < d.offset+rows; i++ {
+		s := statuses[i]
+		line := fmt.Sprintf(format,
+			fmt.Sprint(s.Task),
+			clip(s.Site, 12),
+			clip(s.Product, 24),
+			clip(s.Variant, 14),
+			clip(stateLabel(s), 16),
+			fmt.Sprint(s.Retries),
+			formatElapsed(s.Elapsed()),
+			clip(s.LastError, errWidth))
+		line = fit(line, width)
+		if i == d.selected {
+			line = styleInvert + line + strings.Repeat(" ", width-utf8.RuneCountInString(line)) + styleReset
+		} else {
+			line = stateColor(s) + line + styleReset
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (d *dashboard) linkLines(width int, rows int) []string {
+	links := tasks.CheckoutLinks()
+	lines := []string{styleBold + fit(fmt.Sprintf("%-5s %-12s %-24s %-14s %s", "TASK", "SITE", "PRODUCT", "VARIANT", "CHECKOUT LINK"), width) + styleReset}
+	if len(links) == 0 {
+		return append(lines, styleDim+"No checkouts yet"+styleReset)
+	}
+	rows = max(rows, 1)
+	var body []string
+	for i := len(links) - 1; i >= 0; i-- {
+		entry := linkEntryLines(links[i], width)
+		if len(body)+len(entry) > rows {
+			if len(body) == 0 {
+				body = entry[:rows]
+			}
+			break
+		}
+		body = append(entry, body...)
+	}
+	for _, line := range body {
+		lines = append(lines, styleGreen+line+styleReset)
+	}
+	return lines
+}
+
+func linkEntryLines(link tasks.CheckoutEntry, width int) []string {
+	prefix := fmt.Sprintf("%-5d %-12s %-24s %-14s ", link.Task, clip(link.Site, 12), clip(link.Product, 24), clip(link.Variant, 14))
+	indent := utf8.RuneCountInString(prefix)
+	if width-indent < minLinkWidth {
+		lines := []string{fit(prefix, width)}
+		for _, chunk := range wrapRunes(link.Link, width-2) {
+			lines = append(lines, "  "+chunk)
+		}
+		return lines
+	}
+
+	chunks := wrapRunes(link.Link, width-indent)
+	lines := []string{prefix + chunks[0]}
+	for _, chunk := range chunks[1:] {
+		lines = append(lines, strings.Repeat(" ", indent)+chunk)
+	}
+	return lines
+}
+
+func wrapRunes(s string, n int) []string {
+	runes := []rune(s)
+	if n < 1 {
+		n = 1
+	}
+	chunks := []string{string(runes[:min(n, len(runes))])}
+	for i := n; i < len(runes); i += n {
+		chunks = append(chunks, string(runes[i:min(i+n, len(runes))]))
+	}
+	return chunks
+}
+
+func stateLabel(s tasks.TaskStatus) string {
+	if s.Paused {
+		return s.State.String() + " (paused)"
+	}
+	if s.DryRun && s.State == tasks.StateDone {
+		return s.State.String() + " (dry run)"
+	}
+	return s.State.String()
+}
+
+func stateColor(s tasks.TaskStatus) string {
+	switch {
+	case s.Paused:
+		return styleYellow
+	case s.State == tasks.StateDone:
+		return styleGreen
+	case s.State == tasks.StateFailed:
+		return styleRed
+	case s.State == tasks.StateCanceled:
+		return styleDim
+	case s.State != tasks.StateMonitor:
+		return styleCyan
+	default:
+		return ""
+	}
+}
+
+func totals(statuses []tasks.TaskStatus) string {
+	counts := make(map[tasks.State]int)
+	paused := 0
+	for _, s := range statuses {
+		counts[s.State]++
+		if s.Paused {
+			paused++
+		}
+	}
+
+	var parts []string
+	for _, state := range []tasks.State{tasks.StateMonitor, tasks.StateATC, tasks.StateShipping, tasks.StateOrderPlacement, tasks.StateDone, tasks.StateFailed, tasks.StateCanceled} {
+		parts = append(parts, fmt.Sprintf("%s %d", state, counts[state]))
+	}
+	parts = append(parts, fmt.Sprintf("Paused %d", paused))
+	return "Total " + fmt.Sprint(len(statuses)) + " | " + strings.Join(parts, " | ")
+}
+
+func formatElapsed(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return d.Round(100 * time.Millisecond).String()
+	default:
+		return d.Round(time.Second).String()
+	}
+}
+
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string([]rune(s)[:n])
+	}
+	return string([]rune(s)[:n-1]) + "~"
+}
+
+func fit(s string, width int) string {
+	return clip(strings.ReplaceAll(s, "\n", " "), width)
+}
+
+func printCheckoutLinks(links []tasks.CheckoutEntry) {
+	if len(links) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tSITE\tPRODUCT\tVARIANT\tCHECKOUT LINK")
+	for _, link := range links {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", link.Task, link.Site, link.Product, link.Variant, link.Link)
+	}
+	w.Flush()
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"peak/tasks"
+	"text/tabwriter"
+	"time"
+)
+
+const historyUsage = `Usage: peak history <command> [flags]
+
+Commands:
+  checkouts  Checkouts per site (-since today, 24h or 2006-01-02)
+  failures   Last failure reason per task (-task N for one task)
+  runs       Recent runs (-limit N)
+  export     Export a table (-table runs|attempts|transitions -format csv|json -o file)
+`
+
+var historyCommands = map[string]bool{"checkouts": true, "failures": true, "runs": true, "export": true}
+
+func history(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, historyUsage)
+		return ExitUsage
+	}
+	if !historyCommands[args[0]] {
+		fmt.Fprintf(os.Stderr, "unknown history command: %s\n\n%s", args[0], historyUsage)
+		return ExitUsage
+	}
+
+	fs, files := newFlagSet("history " + args[0])
+	since := fs.String("since", "today", "start of the period: today, a duration such as 24h, or a date")
+	task := fs.Int("task", 0, "task number (default every task)")
+	limit := fs.Int("limit", 10, "number of runs to show")
+	table := fs.String("table", "attempts", "table to export: runs, attempts or transitions")
+	format := fs.String("format", "csv", "export format: csv or json")
+	output := fs.String("o", "", "export file (default stdout)")
+	if err := parseArgs(fs, args[1:]); err != nil {
+		return ExitUsage
+	}
+
+	h, err := tasks.OpenHistory(files.History)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	defer h.Close()
+
+	switch args[0] {
+	case "checkouts":
+		start, err := parseSince(*since)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+		err = printCheckoutsPerSite(os.Stdout, h, start)
+		return exitCode(err)
+	case "failures":
+		return exitCode(printFailures(os.Stdout, h, *task))
+	case "runs":
+		return exitCode(printRuns(os.Stdout, h, *limit))
+	default:
+		return exitCode(exportHistory(h, *table, *format, *output))
+	}
+}
+
+func exitCode(err error) int {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+func parseSince(since string) (time.Time, error) {
+	now := time.Now()
+	if since == "today" {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), nil
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", since, now.Location()); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid -since %q, expected today, a duration such as 24h, or a date such as 2006-01-02", since)
+}
+
+func printCheckoutsPerSite(w io.Writer, h *tasks.History, since time.Time) error {
+	counts, err := h.CheckoutsPerSite(since)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Checkouts since %s\n", since.Format("2006-01-02 15:04"))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SITE\tCHECKOUTS\tATTEMPTS")
+	for _, count := range counts {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", count.Site, count.Checkouts, count.Attempts)
+	}
+	return tw.Flush()
+}
+
+func printFailures(w io.Writer, h *tasks.History, task int) error {
+	failures, err := h.LastFailures(task)
+	if err != nil {
+		return err
+	}
+	if len(failures) == 0 {
+		fmt.Fprintln(w, "No failures recorded")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TASK\tRUN\tSITE\tPRODUCT\tSTATE\tAT\tERROR")
+	for _, failure := range failures {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\t%s\n", failure.Task, failure.RunID, failure.Site, failure.Product, failure.FinalState, failure.FinishedAt.Local().Format("2006-01-02 15:04:05"), failure.Error)
+	}
+	return tw.Flush()
+}
+
+func printRuns(w io.Writer, h *tasks.History, limit int) error {
+	runs, err := h.Runs(limit)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tSTARTED\tDURATION\tTASKS FILE\tTASKS\tCHECKOUTS\tINTERRUPTED")
+	for _, run := range runs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%t\n", run.ID, run.StartedAt.Local().Format("2006-01-02 15:04:05"), run.Duration.Round(time.Millisecond), run.TasksFile, run.Tasks, run.Checkouts, run.Interrupted)
+	}
+	return tw.Flush()
+}
+
+func exportHistory(h *tasks.History, table string, format string, output string) error {
+	if output == "" {
+		return h.Export(os.Stdout, table, format)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", output, err)
+	}
+	if err := h.Export(file, table, format); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %s to %s\n", table, output)
+	return nil
+}
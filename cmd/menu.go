@@ -2,15 +2,18 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"peak/tasks"
+	"strings"
+	"time"
 
 	"github.com/manifoldco/promptui"
 )
 
-func ShowMenu() {
+func ShowMenu(files tasks.Files) {
 	prompt := promptui.Select{
 		Label: "Select an option",
-		Items: []string{"Run Tasks", "Test Proxies", "Exit"},
+		Items: []string{"Run Tasks", "Monitor Restocks", "Test Proxies", "Profiles", "History", "Exit"},
 	}
 
 	for {
@@ -23,12 +26,72 @@ func ShowMenu() {
 
 		switch result {
 		case "Run Tasks":
-			tasks.RunTasks()
+			ctx, stop := interruptContext()
+			if _, err := runTasksInteractive(ctx, stop, files); err != nil {
+				fmt.Println(err)
+			}
+			stop()
+		case "Monitor Restocks":
+			ctx, stop := interruptContext()
+			if err := tasks.WatchSites(ctx, files, nil, 5*time.Second); err != nil {
+				fmt.Println(err)
+			}
+			stop()
 		case "Test Proxies":
-			tasks.TestProxies()
+			if _, err := tasks.TestProxies(files, "", ""); err != nil {
+				fmt.Println(err)
+			}
+		case "Profiles":
+			showProfilesMenu(files)
+		case "History":
+			showHistoryMenu(files)
 		case "Exit":
 			fmt.Println("Exiting...")
 			return
 		}
 	}
 }
+
+func showHistoryMenu(files tasks.Files) {
+	h, err := tasks.OpenHistory(files.History)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer h.Close()
+
+	prompt := promptui.Select{
+		Label: "History",
+		Items: []string{"Checkouts Today", "Last Failures", "Recent Runs", "Export CSV", "Export JSON", "Back"},
+	}
+
+	for {
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		switch result {
+		case "Checkouts Today":
+			since, _ := parseSince("today")
+			err = printCheckoutsPerSite(os.Stdout, h, since)
+		case "Last Failures":
+			err = printFailures(os.Stdout, h, 0)
+		case "Recent Runs":
+			err = printRuns(os.Stdout, h, 10)
+		case "Export CSV", "Export JSON":
+			format := strings.ToLower(strings.TrimPrefix(result, "Export "))
+			for _, table := range []string{"runs", "attempts", "transitions"} {
+				if err = exportHistory(h, table, format, fmt.Sprintf("history_%s.%s", table, format)); err != nil {
+					break
+				}
+			}
+		case "Back":
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"peak/mockstore"
+	"strings"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	fixtures := flag.String("fixtures", "product.json,1-sample.json", "comma separated collection fixture files")
+	dropIn := flag.Duration("drop-in", 0, "return 404 for collection and product pages until this long after start")
+	restockIn := flag.Duration("restock-in", 0, "make products available this long after start")
+	restockHandle := flag.String("restock-handle", "", "product handle to restock (default all products)")
+	xsrfTTL := flag.Duration("xsrf-ttl", 0, "reject XSRF tokens older than this (0 never expires)")
+	oosAfterATC := flag.Bool("oos-after-atc", false, "carted variants go out of stock before order placement")
+	flag.Parse()
+
+	data, err := mockstore.LoadFixtures(strings.Split(*fixtures, ",")...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := mockstore.Options{
+		XSRFTokenTTL: *xsrfTTL,
+		OOSAfterATC:  *oosAfterATC,
+	}
+	if *dropIn > 0 {
+		opts.DropAt = time.Now().Add(*dropIn)
+	}
+
+	store, err := mockstore.New(opts, data...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	if *restockIn > 0 {
+		store.After(*restockIn, func(s *mockstore.Store) {
+			if *restockHandle == "" {
+				s.SetAllAvailable(true)
+				log.Println("restocked all products")
+				return
+			}
+			if err := s.SetAvailable(*restockHandle, true); err != nil {
+				log.Println(err)
+				return
+			}
+			log.Printf("restocked %s", *restockHandle)
+		})
+	}
+
+	fmt.Fprintf(os.Stdout, "Mock EasyStore listening on http://%s (collections at /collections/<handle>)\n", *addr)
+	if err := http.ListenAndServe(*addr, logRequests(store)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
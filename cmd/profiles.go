@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"peak/tasks"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/manifoldco/promptui"
+)
+
+var profileLabels = []struct {
+	column string
+	label  string
+}{
+	{"firstname", "First Name"},
+	{"lastname", "Last Name"},
+	{"email", "Email"},
+	{"phone", "Phone"},
+	{"address_line1", "Address Line 1"},
+	{"address_line2", "Address Line 2"},
+	{"zipcode", "Zipcode"},
+	{"city", "City"},
+	{"state", "State"},
+	{"country", "Country (optional)"},
+	{"cardno", "Card Number (optional, saved to the vault)"},
+	{"expirydate", "Expiry Date (optional, saved to the vault)"},
+	{"cvv", "CVV (optional, saved to the vault)"},
+}
+
+func showProfilesMenu(files tasks.Files) {
+	prompt := promptui.Select{
+		Label: "Profiles",
+		Items: []string{"List Profiles", "Create Profile", "Edit Profile", "Delete Profile", "Back"},
+	}
+
+	for {
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+		if result == "Back" {
+			return
+		}
+
+		store, err := tasks.ReadProfiles(files.Profiles)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		switch result {
+		case "List Profiles":
+			listProfiles(store)
+			continue
+		case "Create Profile":
+			err = createProfile(store)
+		case "Edit Profile":
+			err = editProfile(store)
+		case "Delete Profile":
+			err = deleteProfile(store)
+		}
+		if errors.Is(err, promptui.ErrInterrupt) || errors.Is(err, promptui.ErrAbort) {
+			continue
+		}
+		if err == nil && store.HasSecrets() {
+			err = saveProfileSecrets(files, store)
+		}
+		if err == nil {
+			err = tasks.WriteProfiles(files.Profiles, store)
+		}
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("Saved %s\n", files.Profiles)
+	}
+}
+
+func listProfiles(store *tasks.ProfileStore) {
+	if len(store.Profiles) == 0 {
+		fmt.Println("No profiles yet")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tGROUPS\tNAME\tEMAIL\tCITY\tSTATE\tCARD")
+	for _, name := range store.Names() {
+		profile := store.Find(name)
+		card := "-"
+		if masked, ok := tasks.VaultCard(profile.Name); ok {
+			card = masked
+		} else if profile.CardNo != "" {
+			card = tasks.RedactCard(profile.CardNo)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s %s\t%s\t%s\t%s\t%s\n", profile.Name, strings.Join(profile.Groups, ","), profile.FirstName, profile.LastName, profile.Email, profile.City, profile.State, card)
+	}
+	w.Flush()
+}
+
+func saveProfileSecrets(files tasks.Files, store *tasks.ProfileStore) error {
+	if err := openVaultForWrite(files); err != nil {
+		return err
+	}
+	moved, err := tasks.StoreProfileSecrets(store)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved card details for %d profile(s) to %s\n", moved, files.Vault)
+	return nil
+}
+
+func selectProfile(store *tasks.ProfileStore, label string) (*tasks.Profile, error) {
+	names := store.Names()
+	if len(names) == 0 {
+		return nil, errors.New("no profiles yet")
+	}
+
+	prompt := promptui.Select{Label: label, Items: names}
+	_, name, err := prompt.Run()
+	if err != nil {
+		return nil, err
+	}
+	return store.Find(name), nil
+}
+
+func createProfile(store *tasks.ProfileStore) error {
+	prompt := promptui.Prompt{
+		Label: "Profile Name",
+		Validate: func(input string) error {
+			input = strings.TrimSpace(input)
+			if input == "" {
+				return errors.New("cannot be empty")
+			}
+			if store.Find(input) != nil {
+				return fmt.Errorf("profile %s already exists", input)
+			}
+			return nil
+		},
+	}
+	name, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+
+	profile, err := promptProfile(tasks.Profile{Name: strings.TrimSpace(name)})
+	if err != nil {
+		return err
+	}
+	return store.Put(profile)
+}
+
+func editProfile(store *tasks.ProfileStore) error {
+	existing, err := selectProfile(store, "Edit Profile")
+	if err != nil {
+		return err
+	}
+
+	profile, err := promptProfile(*existing)
+	if err != nil {
+		return err
+	}
+	return store.Put(profile)
+}
+
+func deleteProfile(store *tasks.ProfileStore) error {
+	profile, err := selectProfile(store, "Delete Profile")
+	if err != nil {
+		return err
+	}
+
+	confirm := promptui.Prompt{Label: fmt.Sprintf("Delete profile %s", profile.Name), IsConfirm: true}
+	if _, err := confirm.Run(); err != nil {
+		return err
+	}
+	store.Delete(profile.Name)
+	return nil
+}
+
+func promptProfile(profile tasks.Profile) (tasks.Profile, error) {
+	groups := promptui.Prompt{
+		Label:     "Groups (comma separated, optional)",
+		Default:   strings.Join(profile.Groups, ","),
+		AllowEdit: true,
+	}
+	value, err := groups.Run()
+	if err != nil {
+		return profile, err
+	}
+	profile.Groups = nil
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			profile.Groups = append(profile.Groups, group)
+		}
+	}
+
+	for _, field := range profileLabels {
+		column := field.column
+		prompt := promptui.Prompt{
+			Label:     field.label,
+			Default:   profile.Get(column),
+			AllowEdit: true,
+			Validate: func(input string) error {
+				input = strings.TrimSpace(input)
+				switch {
+				case input == "" && !strings.Contains(field.label, "(optional"):
+					return errors.New("cannot be empty")
+				case input != "" && column == "email":
+					return tasks.ValidateEmail(input)
+				case input != "" && column == "phone":
+					return tasks.ValidatePhone(input)
+				case input != "" && column == "country":
+					_, err := tasks.ParseCountry(input)
+					return err
+				}
+				return nil
+			},
+		}
+		if column == "cvv" || column == "cardno" {
+			prompt.Mask = '*'
+		}
+
+		value, err := prompt.Run()
+		if err != nil {
+			return profile, err
+		}
+		profile.Set(column, strings.TrimSpace(value))
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"peak/tasks"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const vaultPassphraseEnv = "PEAK_VAULT_PASSPHRASE"
+
+func readPassphrase(label string) (string, error) {
+	if passphrase := os.Getenv(vaultPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("no terminal to read the vault passphrase from, set %s", vaultPassphraseEnv)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return strings.TrimSpace(string(passphrase)), nil
+}
+
+func unlockVault(files tasks.Files) error {
+	if !tasks.VaultExists(files.Vault) {
+		return nil
+	}
+
+	passphrase, err := readPassphrase(fmt.Sprintf("Passphrase for %s", files.Vault))
+	if err != nil {
+		return err
+	}
+	if err := tasks.UnlockVault(files.Vault, passphrase); err != nil {
+		return err
+	}
+	fmt.Printf("Unlocked %s\n", files.Vault)
+	return nil
+}
+
+func readNewPassphrase(path string) (string, error) {
+	passphrase, err := readPassphrase(fmt.Sprintf("Passphrase for %s", path))
+	if err != nil {
+		return "", err
+	}
+	if os.Getenv(vaultPassphraseEnv) != "" {
+		return passphrase, nil
+	}
+	confirm, err := readPassphrase("Repeat passphrase")
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func openVaultForWrite(files tasks.Files) error {
+	if tasks.VaultUnlocked() {
+		return nil
+	}
+	if tasks.VaultExists(files.Vault) {
+		return unlockVault(files)
+	}
+
+	passphrase, err := readNewPassphrase(files.Vault)
+	if err != nil {
+		return err
+	}
+	v, err := tasks.CreateVault(files.Vault, passphrase)
+	if err != nil {
+		return err
+	}
+	tasks.SetVault(v)
+	fmt.Printf("Created %s\n", files.Vault)
+	return nil
+}
+
+func importSecrets(args []string) int {
+	files, ok := parseFlags("import", args)
+	if !ok {
+		return ExitUsage
+	}
+
+	var passphrase string
+	var err error
+	if tasks.VaultExists(files.Vault) {
+		passphrase, err = readPassphrase(fmt.Sprintf("Passphrase for %s", files.Vault))
+	} else {
+		passphrase, err = readNewPassphrase(files.Vault)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+
+	if err := tasks.ImportSecrets(*files, passphrase); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	return ExitOK
+}
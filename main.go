@@ -2,10 +2,19 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"peak/cmd"
 )
 
 func main() {
+	args := os.Args[1:]
+	if len(args) == 0 || args[0] == "menu" {
+		printBanner()
+	}
+	os.Exit(cmd.Execute(args))
+}
+
+func printBanner() {
 	fmt.Print(`
  _______    ________   ________        ___    ___  ________   _________   ________   ________   _______           ________   ________   _________   
 |\  ___ \  |\   __  \ |\   ____\      |\  \  /  /||\   ____\ |\___   ___\|\   __  \ |\   __  \ |\  ___ \         |\   __  \ |\   __  \ |\___   ___\ 
@@ -18,5 +27,4 @@ func main() {
                                                                                                                                                     
                                                                                                                                                                                                      
 `)
-	cmd.ShowMenu()
 }
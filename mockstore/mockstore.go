@@ -0,0 +1,643 @@
+package mockstore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	DropAt       time.Time
+	XSRFTokenTTL time.Duration
+	OOSAfterATC  bool
+}
+
+type cart struct {
+	token string
+	items []cartItem
+}
+
+type cartItem struct {
+	productID   string
+	variantID   string
+	productName string
+	variantName string
+	quantity    int
+}
+
+type Store struct {
+	mu         sync.Mutex
+	opts       Options
+	collection map[string]interface{}
+	products   []map[string]interface{}
+	tokens     map[string]time.Time
+	carts      map[string]*cart
+	timers     []*time.Timer
+	orders     int
+}
+
+func LoadFixtures(paths ...string) ([][]byte, error) {
+	var fixtures [][]byte
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening fixture %s: %w", path, err)
+		}
+		fixtures = append(fixtures, data)
+	}
+	return fixtures, nil
+}
+
+func New(opts Options, fixtures ...[]byte) (*Store, error) {
+	s := &Store{
+		opts:   opts,
+		tokens: make(map[string]time.Time),
+		carts:  make(map[string]*cart),
+	}
+
+	seen := make(map[string]bool)
+	for i, fixture := range fixtures {
+		decoder := json.NewDecoder(bytes.NewReader(fixture))
+		decoder.UseNumber()
+
+		var collection map[string]interface{}
+		if err := decoder.Decode(&collection); err != nil {
+			return nil, fmt.Errorf("error decoding fixture %d: %w", i, err)
+		}
+		if s.collection == nil {
+			s.collection = collection
+		}
+
+		products, _ := collection["products"].([]interface{})
+		for _, p := range products {
+			product, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			id := idString(product["id"])
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			s.products = append(s.products, product)
+		}
+	}
+	if s.collection == nil {
+		return nil, fmt.Errorf("at least one collection fixture is required")
+	}
+
+	return s, nil
+}
+
+func NewServer(opts Options, fixtures ...[]byte) (*Store, *httptest.Server, error) {
+	store, err := New(opts, fixtures...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, httptest.NewServer(store), nil
+}
+
+func (s *Store) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, timer := range s.timers {
+		timer.Stop()
+	}
+	s.timers = nil
+}
+
+func (s *Store) At(t time.Time, fn func(*Store)) {
+	s.After(time.Until(t), fn)
+}
+
+func (s *Store) After(d time.Duration, fn func(*Store)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timers = append(s.timers, time.AfterFunc(d, func() { fn(s) }))
+}
+
+func (s *Store) Drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.DropAt = time.Time{}
+}
+
+func (s *Store) SetDropAt(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.DropAt = t
+}
+
+func (s *Store) SetOOSAfterATC(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.OOSAfterATC = enabled
+}
+
+func (s *Store) Orders() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.orders
+}
+
+func (s *Store) Handles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	handles := make([]string, len(s.products))
+	for i, product := range s.products {
+		handles[i], _ = product["handle"].(string)
+	}
+	return handles
+}
+
+func (s *Store) SetAvailable(handle string, available bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product := s.productByHandle(handle)
+	if product == nil {
+		return fmt.Errorf("product not found: %s", handle)
+	}
+	for _, variant := range variantsOf(product) {
+		setVariantStock(variant, available, -1)
+	}
+	refreshProduct(product)
+	return nil
+}
+
+func (s *Store) SetAllAvailable(available bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, product := range s.products {
+		for _, variant := range variantsOf(product) {
+			setVariantStock(variant, available, -1)
+		}
+		refreshProduct(product)
+	}
+}
+
+func (s *Store) SetInventory(variantID int, quantity int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product, variant := s.variantByID(strconv.Itoa(variantID))
+	if variant == nil {
+		return fmt.Errorf("variant not found: %d", variantID)
+	}
+	setVariantStock(variant, quantity > 0, quantity)
+	refreshProduct(product)
+	return nil
+}
+
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodGet && path == "/":
+		s.serveHome(w)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/collections/"):
+		s.serveCollection(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/products/"):
+		s.serveProduct(w, r, strings.TrimPrefix(path, "/products/"))
+	case r.Method == http.MethodPost && path == "/cart/add":
+		s.serveAddToCart(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/sf/countries/") && strings.HasSuffix(path, "/provinces"):
+		country := strings.TrimSuffix(strings.TrimPrefix(path, "/sf/countries/"), "/provinces")
+		s.serveProvinces(w, country)
+	case strings.HasPrefix(path, "/sf/checkout/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/sf/checkout/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut && parts[1] == "shipping_address":
+			s.serveShippingAddress(w, r, parts[0])
+		case r.Method == http.MethodPost && parts[1] == "order_placement":
+			s.serveOrderPlacement(w, r, parts[0])
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Store) serveHome(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setTokenCookie(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<!DOCTYPE html>\n<html>\n<head><title>Mock EasyStore</title></head>\n<body></body>\n</html>\n")
+}
+
+func (s *Store) serveCollection(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.beforeDrop() {
+		s.setTokenCookie(w)
+		http.NotFound(w, r)
+		return
+	}
+
+	collection := make(map[string]interface{}, len(s.collection))
+	for key, value := range s.collection {
+		collection[key] = value
+	}
+	products := make([]interface{}, len(s.products))
+	for i, product := range s.products {
+		products[i] = product
+	}
+	collection["products"] = products
+
+	s.writePage(w, "collection", collection)
+}
+
+func (s *Store) serveProduct(w http.ResponseWriter, r *http.Request, handle string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product := s.productByHandle(handle)
+	if product == nil || s.beforeDrop() {
+		s.setTokenCookie(w)
+		http.NotFound(w, r)
+		return
+	}
+
+	s.writePage(w, "product", product)
+}
+
+func (s *Store) writePage(w http.ResponseWriter, name string, value interface{}) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.setTokenCookie(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><title>%s</title></head>\n<body>\n<script>\nconst %s = %s;\n</script>\n</body>\n</html>\n",
+		name, name, payload)
+}
+
+func (s *Store) serveAddToCart(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		ID       json.Number `json:"id"`
+		Quantity json.Number `json:"quantity"`
+		Token    string      `json:"_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := r.Header.Get("X-XSRF-TOKEN")
+	if token == "" {
+		token = payload.Token
+	}
+	if !s.validToken(token) {
+		writeError(w, 419, "CSRF token mismatch.")
+		return
+	}
+
+	product, variant := s.variantByID(payload.ID.String())
+	if variant == nil {
+		writeError(w, http.StatusNotFound, "variant not found")
+		return
+	}
+	if available, _ := variant["available"].(bool); !available {
+		writeError(w, http.StatusUnprocessableEntity, "Variant is out of stock.")
+		return
+	}
+
+	quantity, err := strconv.Atoi(payload.Quantity.String())
+	if err != nil || quantity < 1 {
+		quantity = 1
+	}
+
+	c := &cart{token: s.newToken()}
+	c.items = append(c.items, cartItem{
+		productID:   idString(product["id"]),
+		variantID:   idString(variant["id"]),
+		productName: stringOf(product["name"]),
+		variantName: stringOf(variant["title"]),
+		quantity:    quantity,
+	})
+	s.carts[c.token] = c
+
+	if s.opts.OOSAfterATC {
+		setVariantStock(variant, false, 0)
+		refreshProduct(product)
+	}
+
+	items := make([]map[string]interface{}, len(c.items))
+	for i, item := range c.items {
+		items[i] = map[string]interface{}{
+			"id":           i + 1,
+			"product_id":   json.Number(item.productID),
+			"variant_id":   json.Number(item.variantID),
+			"product_name": item.productName,
+			"variant_name": item.variantName,
+			"quantity":     item.quantity,
+		}
+	}
+	price, _ := strconv.ParseFloat(idString(product["price"]), 64)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":          len(s.carts),
+		"token":       c.token,
+		"order_token": c.token,
+		"item_count":  len(items),
+		"items":       items,
+		"total_price": strconv.FormatFloat(price*float64(quantity), 'f', 2, 64),
+	})
+}
+
+func (s *Store) serveProvinces(w http.ResponseWriter, country string) {
+	provinces, ok := provincesByCountry[strings.ToUpper(country)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "country not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"provinces": provinces})
+}
+
+func (s *Store) serveShippingAddress(w http.ResponseWriter, r *http.Request, cartToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.checkoutForm(w, r, cartToken); !ok {
+		return
+	}
+
+	checkout := map[string]interface{}{
+		"selected_shipping_method": shippingMethods[0],
+		"shipping_methods":         shippingMethods,
+	}
+	switch r.PostForm.Get("base_delivery_method") {
+	case "pickup":
+		checkout["selected_shipping_method"] = map[string]interface{}{"id": 10, "handle": "self-collect", "title": "Self Collect", "price": "0.00"}
+		delete(checkout, "shipping_methods")
+		checkout["pickup_locations"] = pickupLocations
+	case "delivery":
+		checkout["delivery_slots"] = deliverySlots(time.Now())
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"checkout": checkout})
+}
+
+var shippingMethods = []map[string]interface{}{
+	{"id": 1, "handle": "shipping-standard-1", "title": "Standard Delivery", "price": "8.00", "min_delivery_days": 3, "max_delivery_days": 5},
+	{"id": 2, "handle": "shipping-express-2", "title": "Express Delivery", "price": "15.00", "min_delivery_days": 1, "max_delivery_days": 2},
+	{"id": 3, "handle": "shipping-economy-3", "title": "Economy Post", "price": "5.00", "min_delivery_days": 5, "max_delivery_days": 9},
+}
+
+var pickupLocations = []map[string]interface{}{
+	{"id": 11, "handle": "pickup-bukit-bintang", "name": "PEAK Bukit Bintang", "address": "Lot 10, Jalan Bukit Bintang, 55100 Kuala Lumpur"},
+	{"id": 12, "handle": "pickup-gurney", "name": "PEAK Gurney Plaza", "address": "170 Persiaran Gurney, 10250 Penang"},
+}
+
+func deliverySlots(now time.Time) []map[string]interface{} {
+	var slots []map[string]interface{}
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i := 1; i <= 3; i++ {
+		day = day.AddDate(0, 0, 1)
+		for _, hour := range []int{10, 14} {
+			start := day.Add(time.Duration(hour) * time.Hour)
+			slots = append(slots, map[string]interface{}{
+				"value": start.Format(time.RFC3339),
+				"label": fmt.Sprintf("%s %s - %s", start.Format("Mon 2 Jan"), start.Format("15:04"), start.Add(3*time.Hour).Format("15:04")),
+			})
+		}
+	}
+	return slots
+}
+
+func validDelivery(form url.Values) string {
+	switch form.Get("base_delivery_method") {
+	case "pickup":
+		for _, location := range pickupLocations {
+			if location["handle"] == form.Get("checkout[delivery_method]") {
+				if form.Get("checkout[pickup_address][receiver][first_name]") == "" || form.Get("checkout[pickup_address][receiver][phone]") == "" {
+					return "pickup receiver is incomplete"
+				}
+				return ""
+			}
+		}
+		return "unknown pickup location"
+	case "shipping", "":
+		for _, method := range shippingMethods {
+			if method["handle"] == form.Get("shipping_handle") {
+				return ""
+			}
+		}
+		return "shipping method is not available"
+	case "delivery":
+		for _, slot := range deliverySlots(time.Now()) {
+			if slot["value"] == form.Get("checkout[delivery_datetime]") {
+				return ""
+			}
+		}
+		return "delivery slot is not available"
+	}
+	return ""
+}
+
+func (s *Store) serveOrderPlacement(w http.ResponseWriter, r *http.Request, cartToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.checkoutForm(w, r, cartToken)
+	if !ok {
+		return
+	}
+
+	if message := validDelivery(r.PostForm); message != "" {
+		writeError(w, http.StatusUnprocessableEntity, message)
+		return
+	}
+
+	for _, item := range c.items {
+		_, variant := s.variantByID(item.variantID)
+		if variant == nil {
+			writeError(w, http.StatusUnprocessableEntity, "Variant no longer exists.")
+			return
+		}
+		if available, _ := variant["available"].(bool); !available {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s is out of stock.", item.productName))
+			return
+		}
+	}
+
+	s.orders++
+	delete(s.carts, cartToken)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"redirect_url": fmt.Sprintf("http://%s/sf/checkout/%s/payment", r.Host, cartToken),
+	})
+}
+
+func (s *Store) checkoutForm(w http.ResponseWriter, r *http.Request, cartToken string) (*cart, bool) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form")
+		return nil, false
+	}
+	if !s.validToken(r.PostForm.Get("_token")) {
+		writeError(w, 419, "CSRF token mismatch.")
+		return nil, false
+	}
+	c, ok := s.carts[cartToken]
+	if !ok {
+		writeError(w, http.StatusNotFound, "checkout not found")
+		return nil, false
+	}
+	if missing := missingAddressFields(r.PostForm); len(missing) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, "missing fields: "+strings.Join(missing, ", "))
+		return nil, false
+	}
+	return c, true
+}
+
+func missingAddressFields(form url.Values) []string {
+	var missing []string
+	for _, field := range []string{"address1", "zip", "city", "province_code", "country_code"} {
+		if field == "province_code" && len(provincesByCountry[strings.ToUpper(form.Get("checkout[shipping_address][country_code]"))]) == 0 {
+			continue
+		}
+		if form.Get("checkout[shipping_address]["+field+"]") == "" {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+func (s *Store) setTokenCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: "XSRF-TOKEN", Value: s.issueToken(), Path: "/"})
+}
+
+func (s *Store) beforeDrop() bool {
+	return !s.opts.DropAt.IsZero() && time.Now().Before(s.opts.DropAt)
+}
+
+func (s *Store) issueToken() string {
+	token := s.newToken()
+	s.tokens[token] = time.Now()
+	return token
+}
+
+func (s *Store) validToken(token string) bool {
+	issuedAt, ok := s.tokens[token]
+	if !ok {
+		return false
+	}
+	if s.opts.XSRFTokenTTL > 0 && time.Since(issuedAt) > s.opts.XSRFTokenTTL {
+		delete(s.tokens, token)
+		return false
+	}
+	return true
+}
+
+func (s *Store) newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *Store) productByHandle(handle string) map[string]interface{} {
+	for _, product := range s.products {
+		if product["handle"] == handle {
+			return product
+		}
+	}
+	return nil
+}
+
+func (s *Store) variantByID(id string) (map[string]interface{}, map[string]interface{}) {
+	for _, product := range s.products {
+		for _, variant := range variantsOf(product) {
+			if idString(variant["id"]) == id {
+				return product, variant
+			}
+		}
+	}
+	return nil, nil
+}
+
+func variantsOf(product map[string]interface{}) []map[string]interface{} {
+	raw, _ := product["variants"].([]interface{})
+	variants := make([]map[string]interface{}, 0, len(raw))
+	for _, v := range raw {
+		if variant, ok := v.(map[string]interface{}); ok {
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
+
+func setVariantStock(variant map[string]interface{}, available bool, quantity int) {
+	variant["available"] = available
+	if quantity >= 0 {
+		variant["inventory_quantity"] = quantity
+		return
+	}
+	current, _ := strconv.Atoi(idString(variant["inventory_quantity"]))
+	if available && current <= 0 {
+		variant["inventory_quantity"] = 10
+	}
+	if !available {
+		variant["inventory_quantity"] = 0
+	}
+}
+
+func refreshProduct(product map[string]interface{}) {
+	available := false
+	for _, variant := range variantsOf(product) {
+		if v, _ := variant["available"].(bool); v {
+			available = true
+			break
+		}
+	}
+	product["available"] = available
+}
+
+func idString(v interface{}) string {
+	switch id := v.(type) {
+	case json.Number:
+		return id.String()
+	case int:
+		return strconv.Itoa(id)
+	case string:
+		return id
+	default:
+		return ""
+	}
+}
+
+func stringOf(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"message": message})
+}
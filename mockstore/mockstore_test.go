@@ -0,0 +1,233 @@
+package mockstore_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"peak/mockstore"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fixture = `{
+	"id": 1,
+	"handle": "all",
+	"products": [
+		{
+			"id": 100,
+			"handle": "peak-tee",
+			"name": "Peak Tee",
+			"price": "59.00",
+			"available": true,
+			"variants": [
+				{"id": 1001, "title": "M", "available": true, "inventory_quantity": 5},
+				{"id": 1002, "title": "L", "available": false, "inventory_quantity": 0}
+			]
+		}
+	]
+}`
+
+type client struct {
+	t    *testing.T
+	base string
+	http *http.Client
+}
+
+func newStore(t *testing.T, opts mockstore.Options) (*mockstore.Store, *client) {
+	t.Helper()
+	store, server, err := mockstore.NewServer(opts, []byte(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+		store.Close()
+	})
+
+	jar, _ := cookiejar.New(nil)
+	return store, &client{t: t, base: server.URL, http: &http.Client{Jar: jar}}
+}
+
+func (c *client) do(method string, path string, contentType string, body string) (int, string) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.base+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func (c *client) token() string {
+	c.t.Helper()
+	if status, _ := c.do(http.MethodGet, "/", "", ""); status != http.StatusOK {
+		c.t.Fatalf("home page returned %d", status)
+	}
+	u, _ := url.Parse(c.base)
+	for _, cookie := range c.http.Jar.Cookies(u) {
+		if cookie.Name == "XSRF-TOKEN" {
+			return cookie.Value
+		}
+	}
+	c.t.Fatal("no XSRF-TOKEN cookie")
+	return ""
+}
+
+func (c *client) addToCart(variantID int, token string) (int, string) {
+	c.t.Helper()
+	payload, _ := json.Marshal(map[string]interface{}{"id": variantID, "quantity": "1", "_token": token})
+	status, body := c.do(http.MethodPost, "/cart/add?retrieve=true", "application/json", string(payload))
+	if status != http.StatusOK {
+		return status, body
+	}
+	var cart struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal([]byte(body), &cart); err != nil {
+		c.t.Fatal(err)
+	}
+	return status, cart.Token
+}
+
+func checkoutForm(token string) string {
+	form := url.Values{
+		"_token":                                    {token},
+		"checkout[shipping_address][address1]":      {"1 Jalan Test"},
+		"checkout[shipping_address][zip]":           {"50000"},
+		"checkout[shipping_address][city]":          {"Kuala Lumpur"},
+		"checkout[shipping_address][province_code]": {"KUL"},
+		"checkout[shipping_address][country_code]":  {"MY"},
+		"shipping_handle":                           {"shipping-standard-1"},
+	}
+	return form.Encode()
+}
+
+func (c *client) placeOrder(cartToken string, token string) (int, string) {
+	c.t.Helper()
+	const form = "application/x-www-form-urlencoded"
+	if status, body := c.do(http.MethodPut, "/sf/checkout/"+cartToken+"/shipping_address", form, checkoutForm(token)); status != http.StatusOK {
+		c.t.Fatalf("shipping address returned %d: %s", status, body)
+	}
+	return c.do(http.MethodPost, "/sf/checkout/"+cartToken+"/order_placement", form, checkoutForm(token))
+}
+
+func TestDropReturnsNotFoundUntilDropTime(t *testing.T) {
+	store, c := newStore(t, mockstore.Options{DropAt: time.Now().Add(time.Hour)})
+
+	for _, path := range []string{"/collections/all", "/products/peak-tee"} {
+		if status, _ := c.do(http.MethodGet, path, "", ""); status != http.StatusNotFound {
+			t.Errorf("%s before drop returned %d, want 404", path, status)
+		}
+	}
+
+	store.Drop()
+	status, body := c.do(http.MethodGet, "/collections/all", "", "")
+	if status != http.StatusOK || !strings.Contains(body, "const collection = ") {
+		t.Fatalf("collection after drop returned %d: %s", status, body)
+	}
+	if status, _ := c.do(http.MethodGet, "/products/peak-tee", "", ""); status != http.StatusOK {
+		t.Errorf("product after drop returned %d, want 200", status)
+	}
+}
+
+func TestScheduledDropOpensStore(t *testing.T) {
+	store, c := newStore(t, mockstore.Options{DropAt: time.Now().Add(time.Hour)})
+	store.SetDropAt(time.Now().Add(50 * time.Millisecond))
+
+	if status, _ := c.do(http.MethodGet, "/collections/all", "", ""); status != http.StatusNotFound {
+		t.Fatalf("collection before drop returned %d, want 404", status)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if status, _ := c.do(http.MethodGet, "/collections/all", "", ""); status != http.StatusOK {
+		t.Fatalf("collection after drop returned %d, want 200", status)
+	}
+}
+
+func TestStaleXSRFTokenIsRejected(t *testing.T) {
+	_, c := newStore(t, mockstore.Options{XSRFTokenTTL: 50 * time.Millisecond})
+
+	token := c.token()
+	if status, body := c.addToCart(1001, token); status != http.StatusOK {
+		t.Fatalf("add to cart with fresh token returned %d: %s", status, body)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if status, _ := c.addToCart(1001, token); status != 419 {
+		t.Fatalf("add to cart with stale token returned %d, want 419", status)
+	}
+	if status, body := c.addToCart(1001, c.token()); status != http.StatusOK {
+		t.Fatalf("add to cart with refreshed token returned %d: %s", status, body)
+	}
+}
+
+func TestUnknownTokenIsRejected(t *testing.T) {
+	_, c := newStore(t, mockstore.Options{})
+
+	if status, _ := c.addToCart(1001, "not-a-token"); status != 419 {
+		t.Fatalf("add to cart with unknown token returned %d, want 419", status)
+	}
+}
+
+func TestOutOfStockVariantCannotBeCarted(t *testing.T) {
+	store, c := newStore(t, mockstore.Options{})
+	token := c.token()
+
+	status, body := c.addToCart(1002, token)
+	if status != http.StatusUnprocessableEntity || !strings.Contains(body, "out of stock") {
+		t.Fatalf("add to cart of sold out variant returned %d: %s", status, body)
+	}
+
+	if err := store.SetInventory(1002, 3); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := c.addToCart(1002, token); status != http.StatusOK {
+		t.Fatalf("add to cart after restock returned %d: %s", status, body)
+	}
+}
+
+func TestOutOfStockBetweenATCAndOrderPlacement(t *testing.T) {
+	store, c := newStore(t, mockstore.Options{OOSAfterATC: true})
+	token := c.token()
+
+	status, cartToken := c.addToCart(1001, token)
+	if status != http.StatusOK {
+		t.Fatalf("add to cart returned %d: %s", status, cartToken)
+	}
+
+	status, body := c.placeOrder(cartToken, token)
+	if status != http.StatusUnprocessableEntity || !strings.Contains(body, "out of stock") {
+		t.Fatalf("order placement returned %d: %s, want 422 out of stock", status, body)
+	}
+	if store.Orders() != 0 {
+		t.Fatalf("orders = %d, want 0", store.Orders())
+	}
+}
+
+func TestOrderPlacementSucceedsWhileInStock(t *testing.T) {
+	store, c := newStore(t, mockstore.Options{})
+	token := c.token()
+
+	status, cartToken := c.addToCart(1001, token)
+	if status != http.StatusOK {
+		t.Fatalf("add to cart returned %d: %s", status, cartToken)
+	}
+
+	status, body := c.placeOrder(cartToken, token)
+	if status != http.StatusOK || !strings.Contains(body, "redirect_url") {
+		t.Fatalf("order placement returned %d: %s", status, body)
+	}
+	if store.Orders() != 1 {
+		t.Fatalf("orders = %d, want 1", store.Orders())
+	}
+}
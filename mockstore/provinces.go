@@ -0,0 +1,36 @@
+package mockstore
+
+type province struct {
+	ID         int    `json:"id"`
+	RCountryID int    `json:"r_country_id"`
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+}
+
+var provincesByCountry = map[string][]province{
+	"MY": {
+		{ID: 1, RCountryID: 132, Code: "JHR", Name: "Johor"},
+		{ID: 2, RCountryID: 132, Code: "KDH", Name: "Kedah"},
+		{ID: 3, RCountryID: 132, Code: "KTN", Name: "Kelantan"},
+		{ID: 4, RCountryID: 132, Code: "KUL", Name: "Kuala Lumpur"},
+		{ID: 5, RCountryID: 132, Code: "LBN", Name: "Labuan"},
+		{ID: 6, RCountryID: 132, Code: "MLK", Name: "Melaka"},
+		{ID: 7, RCountryID: 132, Code: "NSN", Name: "Negeri Sembilan"},
+		{ID: 8, RCountryID: 132, Code: "PHG", Name: "Pahang"},
+		{ID: 9, RCountryID: 132, Code: "PNG", Name: "Penang"},
+		{ID: 10, RCountryID: 132, Code: "PRK", Name: "Perak"},
+		{ID: 11, RCountryID: 132, Code: "PLS", Name: "Perlis"},
+		{ID: 12, RCountryID: 132, Code: "PJY", Name: "Putrajaya"},
+		{ID: 13, RCountryID: 132, Code: "SBH", Name: "Sabah"},
+		{ID: 14, RCountryID: 132, Code: "SWK", Name: "Sarawak"},
+		{ID: 15, RCountryID: 132, Code: "SGR", Name: "Selangor"},
+		{ID: 16, RCountryID: 132, Code: "TRG", Name: "Terengganu"},
+	},
+	"SG": {},
+	"BN": {
+		{ID: 17, RCountryID: 33, Code: "BE", Name: "Belait"},
+		{ID: 18, RCountryID: 33, Code: "BM", Name: "Brunei-Muara"},
+		{ID: 19, RCountryID: 33, Code: "TE", Name: "Temburong"},
+		{ID: 20, RCountryID: 33, Code: "TU", Name: "Tutong"},
+	},
+}
@@ -2,9 +2,12 @@ package tasks
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -35,69 +38,121 @@ type CartResponse struct {
 	TotalWeight        string `json:"total_weight"`
 }
 
+type ShippingMethod struct {
+	ID      int         `json:"id"`
+	Handle  string      `json:"handle"`
+	Title   string      `json:"title"`
+	Price   json.Number `json:"price"`
+	MinDays int         `json:"min_delivery_days"`
+	MaxDays int         `json:"max_delivery_days"`
+}
+
+type ShippingCheckout struct {
+	SelectedShippingMethod ShippingMethod   `json:"selected_shipping_method"`
+	ShippingMethods        []ShippingMethod `json:"shipping_methods"`
+	PickupLocations        []PickupLocation `json:"pickup_locations"`
+	DeliverySlots          []DeliverySlot   `json:"delivery_slots"`
+}
+
 type ShippingRateResponse struct {
-	Checkout struct {
-		SelectedShippingMethod struct {
-			ID     int    `json:"id"`
-			Handle string `json:"handle"`
-			Title  string `json:"title"`
-		} `json:"selected_shipping_method"`
-	} `json:"checkout"`
+	Checkout ShippingCheckout `json:"checkout"`
 }
 
 type CheckoutLink struct {
 	CheckoutURL string `json:"redirect_url"`
 }
 
-func addToCart(link string, variantID int, quantity string, xsrfToken string, client *http.Client, idx int) (string, error) {
+type StatusError struct {
+	Action     string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("failed to %s, status code: %d, response body: %s", e.Action, e.StatusCode, e.Body)
+}
+
+func newStatusError(action string, resp *http.Response) *StatusError {
+	bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &StatusError{
+		Action:     action,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(bodyBytes)),
+	}
+}
+
+func mentionsStock(body string) bool {
+	body = strings.ToLower(body)
+	return strings.Contains(body, "out of stock") || strings.Contains(body, "sold out")
+}
+
+func isOutOfStock(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && mentionsStock(statusErr.Body)
+}
+
+func isSoldOut(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnprocessableEntity && mentionsStock(statusErr.Body)
+}
+
+func isRejected(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnprocessableEntity && !mentionsStock(statusErr.Body)
+}
+
+func isTokenExpired(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == 419
+}
+
+func addToCart(ctx context.Context, link string, variantID int, quantity int, xsrfToken string, client *http.Client, log *slog.Logger) (*CartResponse, error) {
 	url := fmt.Sprintf("%v/cart/add?retrieve=true", link)
 	payload := map[string]interface{}{
 		"id":       variantID,
-		"quantity": quantity,
+		"quantity": strconv.Itoa(quantity),
 		"_token":   xsrfToken,
 	}
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal JSON payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal JSON payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonPayload))
 	if err != nil {
-		return "", fmt.Errorf("failed to create POST request: %w", err)
+		return nil, fmt.Errorf("failed to create POST request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-XSRF-TOKEN", xsrfToken)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("[Task %d]failed to send POST request: %w", idx+1, err)
+		return nil, fmt.Errorf("failed to send POST request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		bodyString := string(bodyBytes)
-		return "", fmt.Errorf("[Task %d] received non-200 response: %d, response body: %s", idx+1, resp.StatusCode, bodyString)
+		return nil, newStatusError("add to cart", resp)
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("[Task %d]failed to read response body: %w", idx+1, err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var cartResponse CartResponse
 	if err := json.Unmarshal(bodyBytes, &cartResponse); err != nil {
-		return "", fmt.Errorf("failed to unmarshal JSON response: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal JSON response: %w", err)
 	}
 
-	for idx, item := range cartResponse.Items {
-		fmt.Printf("[Task %d][ATC] Carted: %s | Quantity: %d\n", idx+1, item.ProductName, item.Quantity)
+	for _, item := range cartResponse.Items {
+		log.Info("Carted", "product", item.ProductName, "quantity", item.Quantity)
 	}
 
-	return cartResponse.Token, nil
+	return &cartResponse, nil
 }
 
-func getShippingRate(idx int, link string, client *http.Client, cartToken string, addressLine1 string, postcode string, city string, provinceCode string, xsrfToken string) (string, error) {
+func getShippingRate(ctx context.Context, log *slog.Logger, link string, client *http.Client, cartToken string, addressLine1 string, postcode string, city string, provinceCode string, country string, delivery deliveryChoice, xsrfToken string) (*ShippingCheckout, error) {
 	entrypoint := fmt.Sprintf("%v/sf/checkout/%v/shipping_address", link, cartToken)
 
 	form := url.Values{}
@@ -123,7 +178,7 @@ func getShippingRate(idx int, link string, client *http.Client, cartToken string
 	form.Add("checkout[shipping_address][address1]", addressLine1)
 	form.Add("checkout[shipping_address][province_code]", provinceCode)
 	form.Add("checkout[shipping_address][address2]", "")
-	form.Add("checkout[shipping_address][country_code]", "MY")
+	form.Add("checkout[shipping_address][country_code]", country)
 	form.Add("checkout[shipping_address][city]", city)
 	form.Add("checkout[shipping_address][zip]", postcode)
 	form.Add("shipping_handle", "")
@@ -136,44 +191,48 @@ func getShippingRate(idx int, link string, client *http.Client, cartToken string
 	form.Add("checkout[billing_address][zip]", "")
 	form.Add("payment_category", "")
 	form.Add("checkout[gateway_handle]", "")
+	delivery.apply(form)
 
-	req, err := http.NewRequest("PUT", entrypoint, strings.NewReader(form.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "PUT", entrypoint, strings.NewReader(form.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("failed to create PUT request: %w", err)
+		return nil, fmt.Errorf("failed to create PUT request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send PUT request %w", err)
+		return nil, fmt.Errorf("failed to send PUT request %w", err)
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch shipping rate, status code: %d", resp.StatusCode)
+		return nil, newStatusError("fetch shipping rate", resp)
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response from shipping rate: %w", err)
+		return nil, fmt.Errorf("failed to read response from shipping rate: %w", err)
 	}
 
 	var shippingRateResp ShippingRateResponse
 	if err := json.Unmarshal(bodyBytes, &shippingRateResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
-	shippingRateHandle := shippingRateResp.Checkout.SelectedShippingMethod.Handle
+	if methods := shippingRateResp.Checkout.ShippingMethods; len(methods) > 0 {
+		log.Info("Shipping methods", "methods", describeMethods(methods))
+	}
 
-	fmt.Printf("[Task %d][Shipping Rate] %v \n", idx+1, shippingRateHandle)
+	return &shippingRateResp.Checkout, nil
 
-	return shippingRateHandle, nil
+}
 
+func orderPlacementURL(link string, cartToken string) string {
+	return fmt.Sprintf("%v/sf/checkout/%v/order_placement", link, cartToken)
 }
 
-func getCheckoutLink(link string, client *http.Client, cartToken string, xsrfToken string, shippingRate string, firstname string, lastname string, email string, phone string, address1 string, address2 string, zipcode string, city string, provinceCode string, paymentCategory string, gatewayHandle string) (string, error) {
-	entrypoint := fmt.Sprintf("%v/sf/checkout/%v/order_placement", link, cartToken)
+func orderForm(xsrfToken string, shippingRate string, firstname string, lastname string, email string, phone string, address1 string, address2 string, zipcode string, city string, provinceCode string, country string, delivery deliveryChoice, paymentCategory string, gatewayHandle string) url.Values {
 	form := url.Values{}
 	form.Add("_token", xsrfToken)
 	form.Add("_testing", strconv.FormatBool(false))
@@ -188,7 +247,7 @@ func getCheckoutLink(link string, client *http.Client, cartToken string, xsrfTok
 	form.Add("checkout[pickup_address][receiver][last_name]", "")
 	form.Add("checkout[pickup_address][receiver][email]", "")
 	form.Add("checkout[pickup_address][receiver][phone]", "")
-	form.Add("checkout[delivery_method]", "shipping-standard")
+	form.Add("checkout[delivery_method]", shippingRate)
 	form.Add("checkout[shipping_address][first_name]", "")
 	form.Add("checkout[shipping_address][last_name]", "")
 	form.Add("checkout[shipping_address][email]", "")
@@ -197,7 +256,7 @@ func getCheckoutLink(link string, client *http.Client, cartToken string, xsrfTok
 	form.Add("checkout[shipping_address][address1]", address1)
 	form.Add("checkout[shipping_address][address2]", address2)
 	form.Add("checkout[shipping_address][province_code]", provinceCode)
-	form.Add("checkout[shipping_address][country_code]", "MY")
+	form.Add("checkout[shipping_address][country_code]", country)
 	form.Add("checkout[shipping_address][city]", city)
 	form.Add("checkout[shipping_address][zip]", zipcode)
 	form.Add("shipping_handle", shippingRate)
@@ -210,8 +269,12 @@ func getCheckoutLink(link string, client *http.Client, cartToken string, xsrfTok
 	form.Add("checkout[billing_address][zip]", "")
 	form.Add("payment_category", paymentCategory)
 	form.Add("checkout[gateway_handle]", gatewayHandle)
+	delivery.apply(form)
+	return form
+}
 
-	req, err := http.NewRequest("POST", entrypoint, strings.NewReader(form.Encode()))
+func getCheckoutLink(ctx context.Context, link string, client *http.Client, cartToken string, form url.Values) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", orderPlacementURL(link, cartToken), strings.NewReader(form.Encode()))
 	if err != nil {
 		return "", fmt.Errorf("failed to POST request: %w", err)
 	}
@@ -226,7 +289,7 @@ func getCheckoutLink(link string, client *http.Client, cartToken string, xsrfTok
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get checkout link , status code: %d", resp.StatusCode)
+		return "", newStatusError("get checkout link", resp)
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
@@ -0,0 +1,74 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStockErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err        error
+		outOfStock bool
+		soldOut    bool
+		rejected   bool
+	}{
+		{&StatusError{StatusCode: 422, Body: `{"message":"Variant is out of stock."}`}, true, true, false},
+		{&StatusError{StatusCode: 422, Body: `{"message":"This item is SOLD OUT"}`}, true, true, false},
+		{&StatusError{StatusCode: 422, Body: `{"message":"The quantity may not be greater than 2."}`}, false, false, true},
+		{&StatusError{StatusCode: 422, Body: ""}, false, false, true},
+		{&StatusError{StatusCode: 400, Body: "out of stock"}, true, false, false},
+		{&StatusError{StatusCode: 500, Body: "server error"}, false, false, false},
+		{fmt.Errorf("add to cart: %w", &StatusError{StatusCode: 422, Body: "missing fields: email"}), false, false, true},
+		{errors.New("out of stock"), false, false, false},
+	} {
+		if got := isOutOfStock(tc.err); got != tc.outOfStock {
+			t.Errorf("isOutOfStock(%v) = %v, want %v", tc.err, got, tc.outOfStock)
+		}
+		if got := isSoldOut(tc.err); got != tc.soldOut {
+			t.Errorf("isSoldOut(%v) = %v, want %v", tc.err, got, tc.soldOut)
+		}
+		if got := isRejected(tc.err); got != tc.rejected {
+			t.Errorf("isRejected(%v) = %v, want %v", tc.err, got, tc.rejected)
+		}
+	}
+}
+
+func TestAddToCartStates(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		body      string
+		variantID int
+		want      State
+	}{
+		{422, `{"message":"Variant is out of stock."}`, 0, StateMonitor},
+		{422, `{"message":"The quantity may not be greater than 2."}`, 0, StateFailed},
+		{422, `{"message":"Variant is out of stock."}`, 1001, StateATC},
+		{422, `{"message":"The quantity may not be greater than 2."}`, 1001, StateFailed},
+		{419, `{"message":"CSRF token mismatch."}`, 0, StateMonitor},
+		{500, "server error", 0, StateATC},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+			w.Write([]byte(tc.body))
+		}))
+
+		c := &checkout{
+			task:      Task{Site: "peakkl", Quantity: 3, VariantID: tc.variantID},
+			link:      server.URL,
+			client:    server.Client(),
+			variant:   &Variant{ID: 1001},
+			log:       taskLogger(0, "peakkl"),
+			startTime: time.Now(),
+		}
+		state, err := c.addToCart(context.Background())
+		server.Close()
+		if err == nil || state != tc.want {
+			t.Errorf("add to cart with %d %s (variant_id %d) = %s, %v; want %s", tc.status, tc.body, tc.variantID, state, err, tc.want)
+		}
+	}
+}
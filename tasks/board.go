@@ -0,0 +1,324 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrNoRun = errors.New("no tasks are running")
+
+type TaskStatus struct {
+	Task         int
+	Site         string
+	Product      string
+	Variant      string
+	State        State
+	Paused       bool
+	Running      bool
+	Retries      int
+	LastError    string
+	CheckoutLink string
+	DryRun       bool
+	Started      time.Time
+	Finished     time.Time
+}
+
+func (s TaskStatus) Elapsed() time.Duration {
+	if s.Started.IsZero() {
+		return 0
+	}
+	if s.Finished.IsZero() {
+		return time.Since(s.Started)
+	}
+	return s.Finished.Sub(s.Started)
+}
+
+type CheckoutEntry struct {
+	Task    int
+	Site    string
+	Product string
+	Variant string
+	Link    string
+	At      time.Time
+}
+
+type taskControl struct {
+	running bool
+	paused  bool
+	resume  chan struct{}
+	cancel  context.CancelFunc
+	restart chan struct{}
+}
+
+type runBoard struct {
+	mu       sync.Mutex
+	statuses []TaskStatus
+	controls []*taskControl
+	links    []CheckoutEntry
+	active   int
+	idle     chan struct{}
+}
+
+func newRunBoard(tasks []Task) *runBoard {
+	b := &runBoard{
+		statuses: make([]TaskStatus, len(tasks)),
+		controls: make([]*taskControl, len(tasks)),
+		active:   len(tasks),
+		idle:     make(chan struct{}),
+	}
+	for idx, task := range tasks {
+		b.statuses[idx] = TaskStatus{Task: idx + 1, Site: task.Site, State: StateMonitor}
+		b.controls[idx] = &taskControl{restart: make(chan struct{}, 1)}
+	}
+	if len(tasks) == 0 {
+		close(b.idle)
+	}
+	return b
+}
+
+func (b *runBoard) add(task Task) (int, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.active == 0 {
+		return 0, false
+	}
+	idx := len(b.statuses)
+	b.statuses = append(b.statuses, TaskStatus{Task: idx + 1, Site: task.Site, State: StateMonitor})
+	b.controls = append(b.controls, &taskControl{restart: make(chan struct{}, 1)})
+	b.active++
+	return idx, true
+}
+
+func setBoard(b *runBoard) {
+	registry.setBoard(b)
+}
+
+func currentBoard() *runBoard {
+	return registry.currentBoard()
+}
+
+func (b *runBoard) begin(idx int, monitorCtx context.Context, checkoutCtx context.Context) (context.Context, context.Context, context.CancelFunc) {
+	taskMonitorCtx, cancelMonitor := context.WithCancel(monitorCtx)
+	taskCheckoutCtx, cancelCheckout := context.WithCancel(checkoutCtx)
+	cancel := func() {
+		cancelMonitor()
+		cancelCheckout()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ctl := b.controls[idx]
+	ctl.running = true
+	ctl.cancel = cancel
+	if ctl.paused {
+		ctl.paused = false
+		close(ctl.resume)
+	}
+
+	status := &b.statuses[idx]
+	*status = TaskStatus{Task: status.Task, Site: status.Site, State: StateMonitor, Running: true, Started: time.Now()}
+	return taskMonitorCtx, taskCheckoutCtx, cancel
+}
+
+func (b *runBoard) end(idx int) {
+	b.finish(idx, true)
+}
+
+func (b *runBoard) finish(idx int, restartable bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ctl := b.controls[idx]
+	if !restartable {
+		for len(ctl.restart) > 0 {
+			<-ctl.restart
+		}
+	}
+	ctl.running = false
+	ctl.cancel = nil
+	b.statuses[idx].Running = false
+	b.statuses[idx].Paused = false
+	b.statuses[idx].Finished = time.Now()
+
+	if len(ctl.restart) == 0 {
+		b.active--
+		if b.active == 0 {
+			close(b.idle)
+		}
+	}
+}
+
+func (b *runBoard) awaitRestart(ctx context.Context, idx int) bool {
+	b.mu.Lock()
+	restart := b.controls[idx].restart
+	b.mu.Unlock()
+
+	select {
+	case <-restart:
+		return ctx.Err() == nil
+	case <-b.idle:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (b *runBoard) control(task int) (*taskControl, error) {
+	if task < 1 || task > len(b.controls) {
+		return nil, fmt.Errorf("unknown task %d", task)
+	}
+	return b.controls[task-1], nil
+}
+
+func (b *runBoard) update(idx int, fn func(*TaskStatus)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fn(&b.statuses[idx])
+}
+
+func (b *runBoard) waitIfPaused(ctx context.Context, idx int) error {
+	b.mu.Lock()
+	ctl := b.controls[idx]
+	if !ctl.paused {
+		b.mu.Unlock()
+		return nil
+	}
+	resume := ctl.resume
+	b.mu.Unlock()
+
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func updateStatus(idx int, fn func(*TaskStatus)) {
+	if b := currentBoard(); b != nil {
+		b.update(idx, fn)
+	}
+}
+
+func waitIfPaused(ctx context.Context, idx int) error {
+	if b := currentBoard(); b != nil {
+		return b.waitIfPaused(ctx, idx)
+	}
+	return nil
+}
+
+func recordCheckoutLink(link CheckoutEntry) {
+	if b := currentBoard(); b != nil {
+		b.mu.Lock()
+		b.links = append(b.links, link)
+		b.mu.Unlock()
+	}
+}
+
+func TaskStatuses() []TaskStatus {
+	b := currentBoard()
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]TaskStatus(nil), b.statuses...)
+}
+
+func CheckoutLinks() []CheckoutEntry {
+	b := currentBoard()
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]CheckoutEntry(nil), b.links...)
+}
+
+func StopTask(task int) error {
+	b := currentBoard()
+	if b == nil {
+		return ErrNoRun
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ctl, err := b.control(task)
+	if err != nil {
+		return err
+	}
+	if !ctl.running {
+		return fmt.Errorf("task %d is not running", task)
+	}
+	ctl.cancel()
+	return nil
+}
+
+func RestartTask(task int) error {
+	b := currentBoard()
+	if b == nil {
+		return ErrNoRun
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ctl, err := b.control(task)
+	if err != nil {
+		return err
+	}
+	if len(ctl.restart) > 0 {
+		return nil
+	}
+	if ctl.running {
+		ctl.restart <- struct{}{}
+		ctl.cancel()
+		return nil
+	}
+	if b.active == 0 {
+		return ErrNoRun
+	}
+	b.active++
+	ctl.restart <- struct{}{}
+	return nil
+}
+
+func PauseTask(task int) error {
+	b := currentBoard()
+	if b == nil {
+		return ErrNoRun
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ctl, err := b.control(task)
+	if err != nil {
+		return err
+	}
+	if !ctl.running {
+		return fmt.Errorf("task %d is not running", task)
+	}
+	if !ctl.paused {
+		ctl.paused = true
+		ctl.resume = make(chan struct{})
+		b.statuses[task-1].Paused = true
+	}
+	return nil
+}
+
+func ResumeTask(task int) error {
+	b := currentBoard()
+	if b == nil {
+		return ErrNoRun
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ctl, err := b.control(task)
+	if err != nil {
+		return err
+	}
+	if ctl.paused {
+		ctl.paused = false
+		close(ctl.resume)
+		b.statuses[task-1].Paused = false
+	}
+	return nil
+}
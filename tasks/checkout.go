@@ -0,0 +1,572 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	StateMonitor State = iota
+	StateATC
+	StateShipping
+	StateOrderPlacement
+	StateDone
+	StateFailed
+	StateCanceled
+)
+
+var stateNames = map[State]string{
+	StateMonitor:        "Monitor",
+	StateATC:            "ATC",
+	StateShipping:       "Shipping",
+	StateOrderPlacement: "OrderPlacement",
+	StateDone:           "Done",
+	StateFailed:         "Failed",
+	StateCanceled:       "Canceled",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+func (s State) Terminal() bool {
+	return s == StateDone || s == StateFailed || s == StateCanceled
+}
+
+type RetryPolicy struct {
+	MaxAttempts  int `json:"MaxAttempts"`
+	BackoffMs    int `json:"BackoffMs"`
+	MaxBackoffMs int `json:"MaxBackoffMs"`
+}
+
+var defaultRetryPolicies = map[State]RetryPolicy{
+	StateMonitor:        {MaxAttempts: 0},
+	StateATC:            {MaxAttempts: 5, BackoffMs: 500, MaxBackoffMs: 5000},
+	StateShipping:       {MaxAttempts: 3, BackoffMs: 500, MaxBackoffMs: 5000},
+	StateOrderPlacement: {MaxAttempts: 3, BackoffMs: 500, MaxBackoffMs: 5000},
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := time.Duration(p.BackoffMs) * time.Millisecond
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if p.MaxBackoffMs > 0 && backoff >= time.Duration(p.MaxBackoffMs)*time.Millisecond {
+			return time.Duration(p.MaxBackoffMs) * time.Millisecond
+		}
+	}
+	return backoff
+}
+
+type Transition struct {
+	CheckoutID   int64
+	Task         int
+	Site         string
+	Country      string
+	From         State
+	To           State
+	Attempt      int
+	Err          error
+	Product      *ProductDetail
+	Variant      *Variant
+	CartToken    string
+	ShippingRate string
+	CheckoutLink string
+	DryRun       bool
+	Elapsed      time.Duration
+}
+
+type TransitionHandler func(Transition)
+
+var (
+	transitionMu       sync.RWMutex
+	transitionHandlers = []TransitionHandler{logTransition, notifyTransition, recordTransition}
+)
+
+func OnTransition(handler TransitionHandler) {
+	transitionMu.Lock()
+	defer transitionMu.Unlock()
+	transitionHandlers = append(transitionHandlers, handler)
+}
+
+func emitTransition(t Transition) {
+	transitionMu.RLock()
+	handlers := transitionHandlers
+	transitionMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(t)
+	}
+}
+
+func logTransition(t Transition) {
+	log := taskLogger(t.Task, t.Site).With("state", t.To.String(), "elapsed", t.Elapsed)
+	msg := fmt.Sprintf("%s -> %s", t.From, t.To)
+	switch {
+	case t.To == StateFailed:
+		log.Error(msg, "attempt", t.Attempt, "err", t.Err)
+	case t.Err != nil:
+		log.Warn(msg, "err", t.Err)
+	default:
+		log.Info(msg)
+	}
+}
+
+func notifyTransition(t Transition) {
+	if t.Product == nil || t.Variant == nil {
+		return
+	}
+	if t.To != StateDone && !(t.To == StateFailed && t.From == StateOrderPlacement) {
+		return
+	}
+
+	notify(checkoutNotification(t))
+}
+
+type checkout struct {
+	monitorCtx      context.Context
+	checkoutCtx     context.Context
+	idx             int
+	task            Task
+	link            string
+	productLink     string
+	paymentCategory string
+	gatewayHandle   string
+	client          *http.Client
+	subscription    *Subscription
+	log             *slog.Logger
+	state           State
+	startTime       time.Time
+	sessionTime     time.Duration
+	baseline        chan struct{}
+	checkoutID      int64
+	retries         int
+	lastErr         error
+
+	xsrfToken      string
+	variant        *Variant
+	product        *ProductDetail
+	cartToken      string
+	shippingRate   string
+	shippingCached bool
+	delivery       deliveryChoice
+	checkoutLink   string
+	dryRun         bool
+}
+
+func newCheckout(monitorCtx context.Context, checkoutCtx context.Context, idx int, task Task, monitors *MonitorPool) (*checkout, error) {
+	link, err := GetSiteLink(task.Site)
+	if err != nil {
+		return nil, err
+	}
+
+	productLink, err := GetProductLink(task.Site)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentCategory, gatewayHandle, err := GetPaymentGateway(task.Site)
+	if err != nil {
+		return nil, err
+	}
+
+	directLink := isDirectLink(task.Keyword)
+	if directLink {
+		productLink = task.Keyword
+	}
+
+	c := &checkout{
+		monitorCtx:      monitorCtx,
+		checkoutCtx:     checkoutCtx,
+		idx:             idx,
+		task:            task,
+		link:            link,
+		productLink:     productLink,
+		paymentCategory: paymentCategory,
+		gatewayHandle:   gatewayHandle,
+		client:          newHTTPClient(assignProxy(task.Proxy)),
+		log:             taskLogger(idx, task.Site),
+		startTime:       time.Now(),
+		delivery:        taskDelivery(task),
+	}
+	if task.VariantID == 0 {
+		c.subscription = monitors.Subscribe(task.Site, productLink, directLink, task.Proxy, time.Duration(task.Delay)*time.Millisecond)
+	}
+	return c, nil
+}
+
+func (c *checkout) close() {
+	if c.subscription != nil {
+		c.subscription.Close()
+	}
+}
+
+func (c *checkout) policy(state State) RetryPolicy {
+	policy := defaultRetryPolicies[state]
+	if override, ok := GetRetryPolicy(state); ok {
+		policy = override
+	}
+	if state == StateMonitor && policy.BackoffMs == 0 {
+		policy.BackoffMs = c.task.Delay
+	}
+	return policy
+}
+
+func (c *checkout) context(state State) context.Context {
+	if state == StateMonitor {
+		return c.monitorCtx
+	}
+	return c.checkoutCtx
+}
+
+func (c *checkout) logger() *slog.Logger {
+	return c.log.With("state", c.state.String(), "elapsed", time.Since(c.startTime))
+}
+
+func (c *checkout) run() State {
+	state := StateMonitor
+	attempt := 0
+
+	for !state.Terminal() {
+		c.state = state
+		ctx := c.context(state)
+		if ctx.Err() != nil {
+			c.transition(state, StateCanceled, attempt, ctx.Err())
+			return StateCanceled
+		}
+
+		if waitIfPaused(ctx, c.idx) != nil {
+			continue
+		}
+
+		next, err := c.step(ctx, state)
+		if ctx.Err() != nil {
+			continue
+		}
+
+		if errors.Is(err, errRestockPending) {
+			if sleep(c.monitorCtx, time.Duration(c.task.Delay)*time.Millisecond) != nil {
+				c.transition(state, StateCanceled, attempt, c.monitorCtx.Err())
+				return StateCanceled
+			}
+			continue
+		}
+
+		if next == state {
+			attempt++
+			if err != nil {
+				c.lastErr = err
+			}
+			policy := c.policy(state)
+			if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+				c.transition(state, StateFailed, attempt, fmt.Errorf("retry budget exhausted after %d attempts: %w", attempt, err))
+				return StateFailed
+			}
+			if state != StateMonitor {
+				c.retries++
+				if err != nil {
+					c.logger().Warn("Attempt failed", "attempt", attempt, "err", err)
+				}
+				c.report(state)
+				sleep(ctx, policy.backoff(attempt))
+			}
+			continue
+		}
+
+		c.transition(state, next, attempt, err)
+		if next == StateMonitor {
+			c.reset()
+		}
+		state = next
+		attempt = 0
+	}
+
+	c.state = state
+	return state
+}
+
+func (c *checkout) transition(from State, to State, attempt int, err error) {
+	if err != nil {
+		c.lastErr = err
+	}
+	c.report(to)
+	emitTransition(Transition{
+		CheckoutID:   c.checkoutID,
+		Task:         c.idx,
+		Site:         c.task.Site,
+		Country:      c.task.Country,
+		From:         from,
+		To:           to,
+		Attempt:      attempt,
+		Err:          err,
+		Product:      c.product,
+		Variant:      c.variant,
+		CartToken:    c.cartToken,
+		ShippingRate: c.shippingRate,
+		CheckoutLink: c.checkoutLink,
+		DryRun:       c.dryRun,
+		Elapsed:      time.Since(c.startTime),
+	})
+}
+
+func (c *checkout) report(state State) {
+	updateStatus(c.idx, func(s *TaskStatus) {
+		s.State = state
+		s.Retries = c.retries
+		s.Product, s.Variant = "", ""
+		if c.product != nil {
+			s.Product = c.product.Name
+		}
+		if c.variant != nil {
+			s.Variant = c.variant.Title
+		}
+		if c.lastErr != nil {
+			s.LastError = Redact(c.lastErr.Error())
+		}
+		if c.checkoutLink != "" {
+			s.CheckoutLink = c.checkoutLink
+		}
+		s.DryRun = c.dryRun
+	})
+	if state == StateDone && c.checkoutLink != "" {
+		recordCheckoutLink(CheckoutEntry{Task: c.idx + 1, Site: c.task.Site, Product: c.product.Name, Variant: c.variant.Title, Link: c.checkoutLink, At: time.Now()})
+	}
+}
+
+func (c *checkout) reset() {
+	if c.subscription != nil {
+		c.subscription.drain()
+	}
+	c.xsrfToken = ""
+	c.variant = nil
+	c.product = nil
+	c.cartToken = ""
+	c.shippingRate = ""
+	c.shippingCached = false
+	c.delivery = taskDelivery(c.task)
+	c.checkoutLink = ""
+}
+
+func (c *checkout) step(ctx context.Context, state State) (State, error) {
+	switch state {
+	case StateMonitor:
+		return c.monitor(ctx)
+	case StateATC:
+		return c.addToCart(ctx)
+	case StateShipping:
+		return c.shipping(ctx)
+	case StateOrderPlacement:
+		return c.placeOrder(ctx)
+	default:
+		return StateFailed, fmt.Errorf("unknown state %s", state)
+	}
+}
+
+func (c *checkout) monitor(ctx context.Context) (State, error) {
+	if c.task.VariantID != 0 {
+		return c.fastSession(ctx)
+	}
+
+	if c.xsrfToken == "" {
+		xsrfToken, err := fetchXsrfToken(ctx, c.link, c.client)
+		if err != nil {
+			sleep(ctx, time.Duration(c.policy(StateMonitor).BackoffMs)*time.Millisecond)
+			return StateMonitor, fmt.Errorf("failed to extract XSRF token for site %s: %w", c.task.Site, err)
+		}
+		c.xsrfToken = xsrfToken
+	}
+
+	var snapshot Snapshot
+	select {
+	case snapshot = <-c.subscription.C:
+	case <-ctx.Done():
+		return StateMonitor, ctx.Err()
+	}
+	if snapshot.Err != nil {
+		if snapshot.Transient {
+			return StateMonitor, snapshot.Err
+		}
+		return StateFailed, snapshot.Err
+	}
+
+	var variant *Variant
+	var productDetail []ProductDetail
+	if snapshot.IsDirectLink {
+		variant, productDetail = handleDirectLink(c.task, *snapshot.Product, c.logger())
+	} else {
+		variant, productDetail = handleKeywordMatching(c.task, *snapshot.Collection, c.logger())
+	}
+	if variant == nil {
+		return StateMonitor, nil
+	}
+	if c.task.Mode == ModeRestock && !restockedProduct(snapshot.Events, productDetail[0].ID) {
+		c.logger().Info("Waiting for restock trigger", "product", productDetail[0].Name)
+		return StateMonitor, nil
+	}
+
+	c.variant = variant
+	c.product = &productDetail[0]
+	return StateATC, nil
+}
+
+func (c *checkout) addToCart(ctx context.Context) (State, error) {
+	cart, err := addToCart(ctx, c.link, c.variant.ID, c.task.Quantity, c.xsrfToken, c.client, c.logger())
+	if err != nil {
+		if c.task.VariantID != 0 && isSoldOut(err) {
+			c.logger().Info("Fast mode variant not available yet", "variant_id", c.task.VariantID)
+			return StateATC, errRestockPending
+		}
+		if isRejected(err) {
+			return StateFailed, fmt.Errorf("store rejected variant %d: %w", c.variant.ID, err)
+		}
+		if (c.task.VariantID == 0 && isOutOfStock(err)) || isTokenExpired(err) {
+			return StateMonitor, err
+		}
+		return StateATC, err
+	}
+
+	if c.task.VariantID != 0 {
+		c.fillFromCart(cart)
+	}
+	c.cartToken = cart.Token
+	return StateShipping, nil
+}
+
+func (c *checkout) shipping(ctx context.Context) (State, error) {
+	delivery := taskDelivery(c.task)
+	key := taskShippingKey(c.task)
+	var shipping *ShippingCheckout
+	cached := false
+	if delivery.mode == DeliveryShipping {
+		shipping, cached = cachedShipping(key)
+	}
+	if !cached {
+		var err error
+		shipping, err = getShippingRate(ctx, c.logger(), c.link, c.client, c.cartToken, c.task.AddressLine1, c.task.Zipcode, c.task.City, c.task.ProvinceCode, c.task.Country, delivery, c.xsrfToken)
+		if err != nil {
+			if isTokenExpired(err) {
+				return StateMonitor, err
+			}
+			return StateShipping, err
+		}
+		if delivery.mode == DeliveryShipping {
+			storeShipping(key, shipping)
+		}
+	}
+
+	var err error
+
+	switch delivery.mode {
+	case DeliverySelfCollect:
+		delivery.pickup, err = choosePickup(shipping.PickupLocations, c.task.Pickup)
+	case DeliveryDelivery:
+		delivery.slot, err = chooseSlot(shipping.DeliverySlots, c.task.Slot)
+	}
+	if err != nil {
+		return StateFailed, err
+	}
+	if (delivery.mode == DeliverySelfCollect && shipping.PickupLocations == nil) || (delivery.mode == DeliveryDelivery && shipping.DeliverySlots == nil) {
+		c.logger().Warn("Store did not list pickup locations or delivery slots, sending the task's value unchecked", delivery.attrs()...)
+	} else if delivery.mode != DeliveryShipping {
+		c.logger().Info("Delivery chosen", delivery.attrs()...)
+	}
+
+	method := shipping.SelectedShippingMethod
+	if delivery.mode != DeliverySelfCollect {
+		method, err = chooseShippingMethod(shipping, c.task.Shipping)
+		if err != nil && cached {
+			forgetShipping(key)
+			return StateShipping, fmt.Errorf("cached rate is stale: %w", err)
+		}
+		if err != nil {
+			return StateFailed, err
+		}
+	}
+	c.logger().Info("Shipping rate", "handle", method.Handle, "title", method.Title, "price", method.Price, "cached", cached)
+
+	c.delivery = delivery
+	c.shippingRate = method.Handle
+	c.shippingCached = cached
+	return StateOrderPlacement, nil
+}
+
+func (c *checkout) placeOrder(ctx context.Context) (State, error) {
+	task := c.task
+	form := orderForm(c.xsrfToken, c.shippingRate, task.FirstName, task.LastName, task.Email, task.Phone, task.AddressLine1, task.AddressLine2, task.Zipcode, task.City, task.ProvinceCode, task.Country, c.delivery, c.paymentCategory, c.gatewayHandle)
+	if task.DryRun {
+		c.logger().Info("Dry run, order not placed", "url", orderPlacementURL(c.link, c.cartToken), dryRunForm(form))
+		c.dryRun = true
+		return StateDone, nil
+	}
+
+	checkoutLink, err := getCheckoutLink(ctx, c.link, c.client, c.cartToken, form)
+	if err == nil && checkoutLink == "" {
+		err = errors.New("empty checkout link")
+	}
+	if err != nil {
+		if isShippingUnavailable(err) {
+			if c.shippingCached {
+				forgetShipping(taskShippingKey(task))
+				c.logger().Warn("Cached shipping rate rejected, fetching it again", "handle", c.shippingRate)
+				return StateShipping, err
+			}
+			return StateFailed, fmt.Errorf("shipping method %s is no longer offered: %w", c.shippingRate, err)
+		}
+		if isOutOfStock(err) {
+			c.logger().Warn("Out of stock on checkout", "product", c.product.Name, "variant", c.variant.Title)
+			return StateMonitor, err
+		}
+		if isRejected(err) {
+			return StateFailed, fmt.Errorf("store rejected the order: %w", err)
+		}
+		if isTokenExpired(err) {
+			return StateMonitor, err
+		}
+		return StateOrderPlacement, err
+	}
+
+	c.checkoutLink = checkoutLink
+	c.logger().Info("Checkout success", "product", c.product.Name, "variant", c.variant.Title, "checkout_link", checkoutLink)
+	return StateDone, nil
+}
+
+func dryRunForm(form url.Values) slog.Attr {
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]any, 0, len(keys))
+	for _, key := range keys {
+		value := form.Get(key)
+		if column, ok := secretKey(key); ok {
+			value = redactValue(column, value)
+		}
+		args = append(args, slog.String(key, value))
+	}
+	return slog.Group("form", args...)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -4,27 +4,141 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
+)
+
+const (
+	defaultProxyTestURL     = "https://www.easystore.co"
+	defaultProxyTestTimeout = 10 * time.Second
+	defaultRequestTimeout   = 15 * time.Second
+	defaultShutdownGrace    = 30 * time.Second
+	defaultDeadLetterFile   = "undelivered_webhooks.jsonl"
+	defaultProvinceCache    = "data/provinces_cache.json"
+	defaultProvinceCacheTTL = 24 * time.Hour
+	defaultShippingCacheTTL = 10 * time.Minute
 )
 
 type Config struct {
-	DiscordWebhook string `json:"DiscordWebhook"`
+	DiscordWebhook string                 `json:"DiscordWebhook"`
+	Notifiers      []NotifierConfig       `json:"Notifiers"`
+	Retries        map[string]RetryPolicy `json:"Retries"`
+	ProxyTestURL   string                 `json:"ProxyTestURL"`
+	ProxyTimeoutMs int                    `json:"ProxyTimeoutMs"`
+
+	MonitorProxyGroup string `json:"MonitorProxyGroup"`
+
+	RequestTimeoutMs int    `json:"RequestTimeoutMs"`
+	ShutdownGraceMs  int    `json:"ShutdownGraceMs"`
+	DeadLetterFile   string `json:"DeadLetterFile"`
+	ShowSecrets      bool   `json:"ShowSecrets"`
+	DryRun           bool   `json:"DryRun"`
+
+	ProvinceCacheFile     string `json:"ProvinceCacheFile"`
+	ProvinceCacheTTLHours int    `json:"ProvinceCacheTTLHours"`
+	ShippingCacheTTLMs    int    `json:"ShippingCacheTTLMs"`
 }
 
-var config Config
+func SetDryRun(enabled bool) {
+	registry.SetDryRun(enabled)
+}
+
+func dryRunEnabled() bool {
+	return registry.DryRun()
+}
 
-func LoadConfig() error {
-	bytes, err := os.ReadFile("config.json")
+func LoadConfig(path string) error {
+	bytes, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("error opening config.json file: %w", err)
+		return fmt.Errorf("error opening %s file: %w", path, err)
 	}
 
-	if err := json.Unmarshal(bytes, &config); err != nil {
-		return fmt.Errorf("error unmarshalling config.json: %w", err)
+	var loaded Config
+	if err := json.Unmarshal(bytes, &loaded); err != nil {
+		return fmt.Errorf("error unmarshalling %s: %w", path, err)
 	}
 
+	if err := registry.SetConfig(loaded); err != nil {
+		return fmt.Errorf("error in %s: %w", path, err)
+	}
 	return nil
 }
 
-func GetDiscordWebhook() string {
-	return config.DiscordWebhook
+func GetRetryPolicy(state State) (RetryPolicy, bool) {
+	policy, ok := registry.Config().Retries[state.String()]
+	return policy, ok
+}
+
+func GetProxyTestURL() string {
+	config := registry.Config()
+	if config.ProxyTestURL == "" {
+		return defaultProxyTestURL
+	}
+	return config.ProxyTestURL
+}
+
+func GetProxyTestTimeout() time.Duration {
+	config := registry.Config()
+	if config.ProxyTimeoutMs <= 0 {
+		return defaultProxyTestTimeout
+	}
+	return time.Duration(config.ProxyTimeoutMs) * time.Millisecond
+}
+
+func GetMonitorProxyGroup(taskGroup string) string {
+	if group := registry.Config().MonitorProxyGroup; group != "" {
+		return group
+	}
+	return taskGroup
+}
+
+func GetRequestTimeout() time.Duration {
+	config := registry.Config()
+	if config.RequestTimeoutMs <= 0 {
+		return defaultRequestTimeout
+	}
+	return time.Duration(config.RequestTimeoutMs) * time.Millisecond
+}
+
+func GetShutdownGrace() time.Duration {
+	config := registry.Config()
+	if config.ShutdownGraceMs <= 0 {
+		return defaultShutdownGrace
+	}
+	return time.Duration(config.ShutdownGraceMs) * time.Millisecond
+}
+
+func GetDeadLetterFile() string {
+	config := registry.Config()
+	if config.DeadLetterFile == "" {
+		return defaultDeadLetterFile
+	}
+	return config.DeadLetterFile
+}
+
+func GetProvinceCacheFile() string {
+	config := registry.Config()
+	if config.ProvinceCacheFile == "" {
+		return defaultProvinceCache
+	}
+	return config.ProvinceCacheFile
+}
+
+func GetProvinceCacheTTL() time.Duration {
+	config := registry.Config()
+	if config.ProvinceCacheTTLHours <= 0 {
+		return defaultProvinceCacheTTL
+	}
+	return time.Duration(config.ProvinceCacheTTLHours) * time.Hour
+}
+
+func GetShippingCacheTTL() time.Duration {
+	config := registry.Config()
+	if config.ShippingCacheTTLMs <= 0 {
+		return defaultShippingCacheTTL
+	}
+	return time.Duration(config.ShippingCacheTTLMs) * time.Millisecond
+}
+
+func redactionEnabled() bool {
+	return !registry.Config().ShowSecrets
 }
@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	DeliveryShipping    = "shipping"
+	DeliverySelfCollect = "self-collect"
+	DeliveryDelivery    = "delivery"
+)
+
+var deliveryMethods = map[string]string{
+	DeliveryShipping:    "shipping",
+	DeliverySelfCollect: "pickup",
+	DeliveryDelivery:    "delivery",
+}
+
+type PickupLocation struct {
+	ID      int    `json:"id"`
+	Handle  string `json:"handle"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+type DeliverySlot struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+type Receiver struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+}
+
+type deliveryChoice struct {
+	mode     string
+	receiver Receiver
+	pickup   *PickupLocation
+	slot     *DeliverySlot
+}
+
+func (d deliveryChoice) apply(form url.Values) {
+	switch d.mode {
+	case DeliverySelfCollect:
+		form.Set("base_delivery_method", deliveryMethods[d.mode])
+		form.Set("checkout[pickup_address][is_self_collect]", strconv.FormatBool(true))
+		form.Set("checkout[pickup_address][receiver][first_name]", d.receiver.FirstName)
+		form.Set("checkout[pickup_address][receiver][last_name]", d.receiver.LastName)
+		form.Set("checkout[pickup_address][receiver][email]", d.receiver.Email)
+		form.Set("checkout[pickup_address][receiver][phone]", d.receiver.Phone)
+		form.Del("checkout[delivery_method]")
+		if d.pickup != nil {
+			form.Set("checkout[pickup_address][id]", strconv.Itoa(d.pickup.ID))
+			if d.pickup.Handle != "" {
+				form.Set("checkout[delivery_method]", d.pickup.Handle)
+			}
+		}
+	case DeliveryDelivery:
+		form.Set("base_delivery_method", deliveryMethods[d.mode])
+		form.Set("checkout[pickup_address][is_self_collect]", strconv.FormatBool(false))
+		form.Del("checkout[delivery_method]")
+		if d.slot != nil {
+			form.Set("checkout[delivery_datetime]", d.slot.Value)
+		}
+	}
+}
+
+func (d deliveryChoice) attrs() []any {
+	switch {
+	case d.pickup != nil:
+		return []any{"delivery", d.mode, "pickup", d.pickup.Name}
+	case d.slot != nil:
+		return []any{"delivery", d.mode, "slot", d.slot.Label}
+	default:
+		return []any{"delivery", d.mode}
+	}
+}
+
+func taskDelivery(task Task) deliveryChoice {
+	return deliveryChoice{mode: task.Delivery, receiver: task.Receiver}
+}
+
+func choosePickup(locations []PickupLocation, name string) (*PickupLocation, error) {
+	if locations == nil {
+		id, err := strconv.Atoi(name)
+		if err != nil {
+			return nil, fmt.Errorf("store did not list its pickup locations, set the pickup column to the location's numeric id")
+		}
+		return &PickupLocation{ID: id, Name: name}, nil
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("store offers no pickup locations")
+	}
+	if name == "" {
+		if len(locations) == 1 {
+			return &locations[0], nil
+		}
+		return nil, fmt.Errorf("store has %d pickup locations, set the pickup column to one of: %s", len(locations), pickupNames(locations))
+	}
+
+	var matches []*PickupLocation
+	for i := range locations {
+		location := &locations[i]
+		if strings.EqualFold(location.Handle, name) || strings.EqualFold(location.Name, name) {
+			return location, nil
+		}
+		if strings.Contains(strings.ToLower(location.Name), strings.ToLower(name)) {
+			matches = append(matches, location)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return nil, fmt.Errorf("no pickup location matches %q, available: %s", name, pickupNames(locations))
+	default:
+		return nil, fmt.Errorf("pickup %q matches %d locations, available: %s", name, len(matches), pickupNames(locations))
+	}
+}
+
+func chooseSlot(slots []DeliverySlot, name string) (*DeliverySlot, error) {
+	if slots == nil {
+		if name == "" || strings.EqualFold(name, "earliest") {
+			return nil, fmt.Errorf("store did not list its delivery slots, set the slot column to the slot's datetime value")
+		}
+		return &DeliverySlot{Value: name, Label: name}, nil
+	}
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("store offers no delivery slots")
+	}
+	if name == "" || strings.EqualFold(name, "earliest") {
+		return &slots[0], nil
+	}
+
+	for i := range slots {
+		if strings.EqualFold(slots[i].Value, name) || strings.EqualFold(slots[i].Label, name) {
+			return &slots[i], nil
+		}
+	}
+	for i := range slots {
+		if strings.Contains(strings.ToLower(slots[i].Label), strings.ToLower(name)) || strings.HasPrefix(slots[i].Value, name) {
+			return &slots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no delivery slot matches %q, available: %s", name, slotLabels(slots))
+}
+
+func pickupNames(locations []PickupLocation) string {
+	names := make([]string, len(locations))
+	for i, location := range locations {
+		names[i] = fmt.Sprintf("%q", location.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func slotLabels(slots []DeliverySlot) string {
+	labels := make([]string, len(slots))
+	for i, slot := range slots {
+		labels[i] = fmt.Sprintf("%q", slot.Label)
+	}
+	return strings.Join(labels, ", ")
+}
@@ -0,0 +1,87 @@
+package tasks
+
+import "testing"
+
+var testLocations = []PickupLocation{
+	{ID: 1, Handle: "pickup-kl", Name: "Peak KL Bangsar"},
+	{ID: 2, Handle: "pickup-penang", Name: "Peak Penang Gurney"},
+}
+
+var testSlots = []DeliverySlot{
+	{Value: "2026-10-17 10:00", Label: "Sat 17 Oct, 10:00 - 12:00"},
+	{Value: "2026-10-17 14:00", Label: "Sat 17 Oct, 14:00 - 16:00"},
+}
+
+func TestChoosePickup(t *testing.T) {
+	for _, tc := range []struct {
+		locations []PickupLocation
+		name      string
+		want      int
+		ok        bool
+	}{
+		{testLocations, "pickup-kl", 1, true},
+		{testLocations, "peak penang gurney", 2, true},
+		{testLocations, "gurney", 2, true},
+		{testLocations, "peak", 0, false},
+		{testLocations, "ipoh", 0, false},
+		{testLocations, "", 0, false},
+		{testLocations[:1], "", 1, true},
+		{[]PickupLocation{}, "pickup-kl", 0, false},
+		{nil, "42", 42, true},
+		{nil, "gurney", 0, false},
+	} {
+		got, err := choosePickup(tc.locations, tc.name)
+		if (err == nil) != tc.ok {
+			t.Errorf("choosePickup(%v, %q) error = %v, want ok %v", tc.locations, tc.name, err, tc.ok)
+			continue
+		}
+		if tc.ok && got.ID != tc.want {
+			t.Errorf("choosePickup(%v, %q) = %d, want %d", tc.locations, tc.name, got.ID, tc.want)
+		}
+	}
+}
+
+func TestChooseSlot(t *testing.T) {
+	for _, tc := range []struct {
+		slots []DeliverySlot
+		name  string
+		want  string
+		ok    bool
+	}{
+		{testSlots, "", "2026-10-17 10:00", true},
+		{testSlots, "earliest", "2026-10-17 10:00", true},
+		{testSlots, "14:00", "2026-10-17 14:00", true},
+		{testSlots, "2026-10-17 14:00", "2026-10-17 14:00", true},
+		{testSlots, "Sun 18 Oct", "", false},
+		{[]DeliverySlot{}, "", "", false},
+		{nil, "2026-10-18 09:00", "2026-10-18 09:00", true},
+		{nil, "earliest", "", false},
+	} {
+		got, err := chooseSlot(tc.slots, tc.name)
+		if (err == nil) != tc.ok {
+			t.Errorf("chooseSlot(%v, %q) error = %v, want ok %v", tc.slots, tc.name, err, tc.ok)
+			continue
+		}
+		if tc.ok && got.Value != tc.want {
+			t.Errorf("chooseSlot(%v, %q) = %q, want %q", tc.slots, tc.name, got.Value, tc.want)
+		}
+	}
+}
+
+func TestDeliveryChoiceSetsDeliveryMethod(t *testing.T) {
+	for _, tc := range []struct {
+		choice deliveryChoice
+		want   []string
+	}{
+		{deliveryChoice{mode: DeliveryShipping}, []string{"shipping-express-2"}},
+		{deliveryChoice{mode: DeliverySelfCollect, pickup: &testLocations[1]}, []string{"pickup-penang"}},
+		{deliveryChoice{mode: DeliverySelfCollect, pickup: &PickupLocation{ID: 42, Name: "42"}}, nil},
+		{deliveryChoice{mode: DeliveryDelivery, slot: &testSlots[0]}, nil},
+	} {
+		form := orderForm("token", "shipping-express-2", "", "", "", "", "", "", "", "", "", "MY", tc.choice, "", "")
+		got := form["checkout[delivery_method]"]
+		if len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) {
+			t.Errorf("%s delivery_method = %v, want %v", tc.choice.mode, got, tc.want)
+		}
+	}
+}
@@ -1,10 +1,8 @@
 package tasks
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 	"time"
 )
 
@@ -51,42 +49,76 @@ type Hook struct {
 	Attachments []Attachment `json:"attachments"`
 }
 
-func postToDiscord(idx int, productName string, variant string, price float64, imageUrl string, checkoutLink string, discordWebhook string) error {
+type DiscordNotifier struct {
+	WebhookURL string
+	Queue      *DiscordQueue
+}
+
+func NewDiscordNotifier(webhookURL string) *DiscordNotifier {
+	return &DiscordNotifier{WebhookURL: webhookURL, Queue: registry.DiscordQueue()}
+}
+
+func (d *DiscordNotifier) Notify(ctx context.Context, n Notification) error {
+	if n.Event != nil {
+		d.Queue.Enqueue(d.WebhookURL, eventHook(*n.Event))
+		return nil
+	}
+	d.Queue.Enqueue(d.WebhookURL, checkoutHook(n))
+	return nil
+}
+
+func checkoutHook(n Notification) Hook {
 	now := time.Now()
 	timestamp := fmt.Sprintf("%02d:%02d:%02d.%03d", now.Hour(), now.Minute(), now.Second(), now.Nanosecond()/1e6)
 	fields := []Field{
 		{
 			Name:   "Product Name",
-			Value:  productName,
+			Value:  n.Product,
 			Inline: false,
 		},
 		{
 			Name:   "Variant",
-			Value:  variant,
+			Value:  n.Variant,
 			Inline: false,
 		},
 		{
 			Name:   "Price",
-			Value:  fmt.Sprintf("%.2f", price),
+			Value:  fmt.Sprintf("%.2f", n.Price),
 			Inline: false,
 		},
 		{
 			Name:   "Task No",
-			Value:  fmt.Sprintf("%d", idx+1),
+			Value:  fmt.Sprintf("%d", n.Task),
 			Inline: false,
 		},
 	}
+	if n.Country != "" {
+		fields = append(fields, Field{
+			Name:   "Country",
+			Value:  n.Country,
+			Inline: false,
+		})
+	}
 
-	embedTitle := productName
+	embedTitle := n.Product
 	embedColor := 0x00FF00
 
-	if checkoutLink == "" {
+	switch {
+	case n.Kind == NotifyFailure:
 		embedTitle = "Checkout Failed!"
 		embedColor = 0xFF0000
-	} else {
+	case n.DryRun:
+		embedTitle = "[DRY RUN] " + n.Product
+		embedColor = 0xFFA500
+		fields = append(fields, Field{
+			Name:   "Dry Run",
+			Value:  "Stopped before order placement, no order was created",
+			Inline: false,
+		})
+	default:
 		fields = append(fields, Field{
 			Name:   "Checkout Link",
-			Value:  fmt.Sprintf("||%s||", checkoutLink),
+			Value:  fmt.Sprintf("||%s||", n.CheckoutLink),
 			Inline: false,
 		})
 	}
@@ -98,39 +130,77 @@ func postToDiscord(idx int, productName string, variant string, price float64, i
 		Color:     embedColor,
 		Timestamp: now,
 		Thumbnail: Thumbnail{
-			Url: imageUrl,
+			Url: n.ImageURL,
 		},
 		Footer: Footer{
 			Text: fmt.Sprintf("v2 | Easystore Bot - %s", timestamp),
 		},
 	}
 
-	hook := Hook{
+	return Hook{
 		Username: "Easystore Bot",
 		Embeds:   []Embed{embed},
 	}
+}
 
-	payload, err := json.Marshal(hook)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+func eventHook(event StockEvent) Hook {
+	now := time.Now()
+	timestamp := fmt.Sprintf("%02d:%02d:%02d.%03d", now.Hour(), now.Minute(), now.Second(), now.Nanosecond()/1e6)
+	fields := []Field{
+		{
+			Name:   "Site",
+			Value:  event.Site,
+			Inline: true,
+		},
+		{
+			Name:   "Price",
+			Value:  fmt.Sprintf("%.2f", event.Product.Price),
+			Inline: true,
+		},
 	}
 
-	req, err := http.NewRequest("POST", discordWebhook, bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("failed to create POST request: %w", err)
+	switch event.Kind {
+	case EventVariantRestocked, EventInventoryChanged:
+		fields = append(fields, Field{
+			Name:   "Variant",
+			Value:  event.Variant.Title,
+			Inline: false,
+		}, Field{
+			Name:   "Stock",
+			Value:  fmt.Sprintf("%d -> %d", event.OldInventory, event.NewInventory),
+			Inline: false,
+		})
+	case EventPriceChanged:
+		fields = append(fields, Field{
+			Name:   "Old Price",
+			Value:  fmt.Sprintf("%.2f", event.OldPrice),
+			Inline: false,
+		})
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send POST request: %w", err)
+	embedColor := 0x3498DB
+	if event.Kind.Restock() {
+		embedColor = 0x00FF00
+	} else if event.Kind == EventProductRemoved {
+		embedColor = 0xFF0000
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("received non-204 response status: %d", resp.StatusCode)
+	embed := Embed{
+		Title:       fmt.Sprintf("%s: %s", event.Kind, event.Product.Name),
+		Description: event.Product.URL,
+		Fields:      fields,
+		Color:       embedColor,
+		Timestamp:   now,
+		Thumbnail: Thumbnail{
+			Url: event.Product.ImgURL,
+		},
+		Footer: Footer{
+			Text: fmt.Sprintf("v2 | Easystore Monitor - %s", timestamp),
+		},
 	}
 
-	return nil
+	return Hook{
+		Username: "Easystore Bot",
+		Embeds:   []Embed{embed},
+	}
 }
@@ -0,0 +1,281 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	discordMaxAttempts = 8
+	discordBackoff     = time.Second
+	discordMaxBackoff  = 30 * time.Second
+	discordQueueSize   = 256
+)
+
+var (
+	errQueueAborted = errors.New("shutdown before delivery")
+	errQueueFull    = errors.New("too many webhooks waiting to be sent")
+)
+
+type discordDelivery struct {
+	webhookURL string
+	hook       Hook
+	queuedAt   time.Time
+}
+
+type DiscordQueue struct {
+	client         *http.Client
+	deadLetterPath func() string
+	jobs           chan discordDelivery
+	startOnce      sync.Once
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+	abort   chan struct{}
+	resetAt map[string]time.Time
+}
+
+func NewDiscordQueue(client *http.Client, deadLetterPath func() string) *DiscordQueue {
+	q := &DiscordQueue{
+		client:         client,
+		deadLetterPath: deadLetterPath,
+		jobs:           make(chan discordDelivery, discordQueueSize),
+		abort:          make(chan struct{}),
+		resetAt:        make(map[string]time.Time),
+	}
+	q.idle = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *DiscordQueue) Enqueue(webhookURL string, hook Hook) {
+	q.startOnce.Do(func() { go q.run() })
+
+	job := discordDelivery{webhookURL: webhookURL, hook: hook, queuedAt: time.Now()}
+	q.mu.Lock()
+	select {
+	case q.jobs <- job:
+		q.pending++
+		q.mu.Unlock()
+		return
+	default:
+		q.mu.Unlock()
+	}
+
+	Logger().Warn("Discord queue is full, saving webhook to the dead-letter file")
+	if err := q.deadLetter(job, errQueueFull); err != nil {
+		Logger().Error("Failed to save undelivered Discord webhook", "err", err)
+	}
+}
+
+func (q *DiscordQueue) Flush(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		q.mu.Lock()
+		for q.pending > 0 {
+			q.idle.Wait()
+		}
+		q.mu.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+	}
+
+	q.mu.Lock()
+	close(q.abort)
+	q.mu.Unlock()
+	<-done
+
+	q.mu.Lock()
+	q.abort = make(chan struct{})
+	q.mu.Unlock()
+	return false
+}
+
+func (q *DiscordQueue) run() {
+	for job := range q.jobs {
+		if err := q.deliver(job); err != nil {
+			Logger().Warn("Discord delivery failed", "err", err)
+			if dlErr := q.deadLetter(job, err); dlErr != nil {
+				Logger().Error("Failed to save undelivered Discord webhook", "err", dlErr)
+			}
+		}
+
+		q.mu.Lock()
+		q.pending--
+		if q.pending == 0 {
+			q.idle.Broadcast()
+		}
+		q.mu.Unlock()
+	}
+}
+
+func (q *DiscordQueue) aborted() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.abort
+}
+
+func (q *DiscordQueue) wait(d time.Duration) error {
+	if d <= 0 {
+		select {
+		case <-q.aborted():
+			return errQueueAborted
+		default:
+			return nil
+		}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-q.aborted():
+		return errQueueAborted
+	}
+}
+
+func (q *DiscordQueue) rateLimitWait(webhookURL string) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return time.Until(q.resetAt[webhookURL])
+}
+
+func (q *DiscordQueue) deliver(job discordDelivery) error {
+	var lastErr error
+	for attempt := 1; attempt <= discordMaxAttempts; attempt++ {
+		if err := q.wait(q.rateLimitWait(job.webhookURL)); err != nil {
+			if lastErr == nil {
+				return err
+			}
+			return fmt.Errorf("%w, last error: %v", err, lastErr)
+		}
+
+		retryAfter, err := q.send(job)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode < 500 && statusErr.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+
+		if retryAfter == 0 {
+			retryAfter = RetryPolicy{BackoffMs: int(discordBackoff / time.Millisecond), MaxBackoffMs: int(discordMaxBackoff / time.Millisecond)}.backoff(attempt)
+		}
+		if err := q.wait(retryAfter); err != nil {
+			return fmt.Errorf("%w, last error: %v", err, lastErr)
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", discordMaxAttempts, lastErr)
+}
+
+func (q *DiscordQueue) send(job discordDelivery) (time.Duration, error) {
+	resp, err := postJSON(context.Background(), q.client, job.webhookURL, job.hook, nil)
+	if err != nil {
+		return 0, err
+	}
+	q.updateRateLimit(job.webhookURL, resp.Header)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := retryAfterDelay(resp)
+		err := newStatusError("post to Discord", resp)
+		resp.Body.Close()
+		return retryAfter, err
+	}
+	return 0, expectStatus(resp, "post to Discord", http.StatusOK, http.StatusNoContent)
+}
+
+func (q *DiscordQueue) updateRateLimit(webhookURL string, header http.Header) {
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+	resetAfter, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.resetAt[webhookURL] = time.Now().Add(time.Duration(resetAfter * float64(time.Second)))
+}
+
+func retryAfterDelay(resp *http.Response) time.Duration {
+	if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	var body struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if json.Unmarshal(bodyBytes, &body) == nil && body.RetryAfter > 0 {
+		return time.Duration(body.RetryAfter * float64(time.Second))
+	}
+	return 0
+}
+
+type deadLetter struct {
+	At         time.Time `json:"at"`
+	QueuedAt   time.Time `json:"queued_at"`
+	WebhookURL string    `json:"webhook_url"`
+	Error      string    `json:"error"`
+	Payload    Hook      `json:"payload"`
+}
+
+func (q *DiscordQueue) deadLetter(job discordDelivery, cause error) error {
+	path := q.deadLetterPath()
+	line, err := json.Marshal(deadLetter{
+		At:         time.Now(),
+		QueuedAt:   job.queuedAt,
+		WebhookURL: job.webhookURL,
+		Error:      cause.Error(),
+		Payload:    job.hook,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	Logger().Warn("Saved undelivered Discord webhook", "path", path)
+	return nil
+}
+
+func FlushNotifications() {
+	deadline := time.Now().Add(GetShutdownGrace())
+	if !registry.NotifyQueue().Flush(GetShutdownGrace()) {
+		Logger().Warn("Notification flush timed out, unsent notifications were canceled")
+	}
+	if !registry.DiscordQueue().Flush(time.Until(deadline)) {
+		Logger().Warn("Discord flush timed out, undelivered webhooks saved to dead-letter file", "path", GetDeadLetterFile())
+	}
+}
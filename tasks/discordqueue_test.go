@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscordQueueRetriesRateLimit(t *testing.T) {
+	server := newRecorder(t, func(w http.ResponseWriter, attempt int) {
+		if attempt == 1 {
+			w.Header().Set("Retry-After", "0.05")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	discord, deadLetters := newTestDiscord(t, server)
+
+	discord.Notify(context.Background(), testCheckout())
+	if !discord.Queue.Flush(5 * time.Second) {
+		t.Fatal("queue did not drain")
+	}
+	if got := len(server.received()); got != 2 {
+		t.Fatalf("got %d requests, want 2", got)
+	}
+	if _, err := os.Stat(deadLetters); err == nil {
+		t.Fatal("delivered webhook was written to the dead-letter file")
+	}
+}
+
+func TestDiscordQueueDeadLettersRejectedWebhook(t *testing.T) {
+	server := newRecorder(t, func(w http.ResponseWriter, _ int) {
+		http.Error(w, `{"message": "Invalid Webhook Token"}`, http.StatusUnauthorized)
+	})
+	discord, deadLetters := newTestDiscord(t, server)
+
+	discord.Notify(context.Background(), testCheckout())
+	if !discord.Queue.Flush(5 * time.Second) {
+		t.Fatal("queue did not drain")
+	}
+	if got := len(server.received()); got != 1 {
+		t.Fatalf("got %d requests, want 1 (4xx is not retried)", got)
+	}
+
+	data, err := os.ReadFile(deadLetters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var letter deadLetter
+	if err := json.Unmarshal(data, &letter); err != nil {
+		t.Fatal(err)
+	}
+	if letter.WebhookURL != server.URL || !strings.Contains(letter.Error, "401") || letter.Payload.Embeds[0].Title != "Peak Tee" {
+		t.Errorf("dead letter = %+v", letter)
+	}
+}
+
+func TestDiscordQueueDeadLettersWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	server := newRecorder(t, func(w http.ResponseWriter, _ int) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+	discord, deadLetters := newTestDiscord(t, server)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < discordQueueSize+2; i++ {
+			discord.Notify(context.Background(), testCheckout())
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify blocked on a full queue")
+	}
+	close(release)
+
+	data, err := os.ReadFile(deadLetters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines < 1 || !strings.Contains(string(data), errQueueFull.Error()) {
+		t.Errorf("dead-letter file has %d lines, want the overflow saved: %s", lines, data)
+	}
+	if !discord.Queue.Flush(5 * time.Second) {
+		t.Fatal("queue did not drain")
+	}
+}
@@ -0,0 +1,132 @@
+package tasks
+
+import (
+	"fmt"
+	"time"
+)
+
+type StockEventKind int
+
+const (
+	EventProductAdded StockEventKind = iota
+	EventProductAvailable
+	EventVariantRestocked
+	EventInventoryChanged
+	EventPriceChanged
+	EventProductRemoved
+)
+
+var stockEventNames = map[StockEventKind]string{
+	EventProductAdded:     "New Product",
+	EventProductAvailable: "Product Available",
+	EventVariantRestocked: "Variant Restocked",
+	EventInventoryChanged: "Inventory Changed",
+	EventPriceChanged:     "Price Changed",
+	EventProductRemoved:   "Product Removed",
+}
+
+func (k StockEventKind) String() string {
+	if name, ok := stockEventNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("StockEventKind(%d)", int(k))
+}
+
+func (k StockEventKind) Restock() bool {
+	return k == EventProductAdded || k == EventProductAvailable || k == EventVariantRestocked
+}
+
+type StockEvent struct {
+	Kind         StockEventKind
+	Site         string
+	Product      Product
+	Variant      *Variant
+	OldInventory int
+	NewInventory int
+	OldPrice     float64
+	NewPrice     float64
+	At           time.Time
+}
+
+func (e StockEvent) String() string {
+	switch e.Kind {
+	case EventVariantRestocked:
+		return fmt.Sprintf("[%s][%s] %s | Variant: %s | Stock: %d", e.Site, e.Kind, e.Product.Name, e.Variant.Title, e.NewInventory)
+	case EventInventoryChanged:
+		return fmt.Sprintf("[%s][%s] %s | Variant: %s | Stock: %d -> %d", e.Site, e.Kind, e.Product.Name, e.Variant.Title, e.OldInventory, e.NewInventory)
+	case EventPriceChanged:
+		return fmt.Sprintf("[%s][%s] %s | Price: %.2f -> %.2f", e.Site, e.Kind, e.Product.Name, e.OldPrice, e.NewPrice)
+	default:
+		return fmt.Sprintf("[%s][%s] %s", e.Site, e.Kind, e.Product.Name)
+	}
+}
+
+func DiffCollections(site string, prev *Collection, curr *Collection) []StockEvent {
+	if prev == nil || curr == nil {
+		return nil
+	}
+
+	now := time.Now()
+	var events []StockEvent
+	emit := func(event StockEvent) {
+		event.Site = site
+		event.At = now
+		events = append(events, event)
+	}
+
+	previous := make(map[int]Product, len(prev.Products))
+	for _, product := range prev.Products {
+		previous[product.ID] = product
+	}
+
+	current := make(map[int]bool, len(curr.Products))
+	for _, product := range curr.Products {
+		current[product.ID] = true
+
+		old, ok := previous[product.ID]
+		if !ok {
+			emit(StockEvent{Kind: EventProductAdded, Product: product, NewPrice: product.Price})
+			continue
+		}
+
+		if product.Available && !old.Available {
+			emit(StockEvent{Kind: EventProductAvailable, Product: product})
+		}
+
+		if product.Price != old.Price {
+			emit(StockEvent{Kind: EventPriceChanged, Product: product, OldPrice: old.Price, NewPrice: product.Price})
+		}
+
+		oldVariants := make(map[int]Variant, len(old.Variants))
+		for _, variant := range old.Variants {
+			oldVariants[variant.ID] = variant
+		}
+		for i := range product.Variants {
+			variant := &product.Variants[i]
+			oldVariant, ok := oldVariants[variant.ID]
+			switch {
+			case !ok && variant.Available, ok && variant.Available && !oldVariant.Available:
+				emit(StockEvent{Kind: EventVariantRestocked, Product: product, Variant: variant, OldInventory: oldVariant.InventoryQuantity, NewInventory: variant.InventoryQuantity})
+			case ok && variant.InventoryQuantity != oldVariant.InventoryQuantity:
+				emit(StockEvent{Kind: EventInventoryChanged, Product: product, Variant: variant, OldInventory: oldVariant.InventoryQuantity, NewInventory: variant.InventoryQuantity})
+			}
+		}
+	}
+
+	for _, product := range prev.Products {
+		if !current[product.ID] {
+			emit(StockEvent{Kind: EventProductRemoved, Product: product})
+		}
+	}
+
+	return events
+}
+
+func restockedProduct(events []StockEvent, productID int) bool {
+	for _, event := range events {
+		if event.Kind.Restock() && event.Product.ID == productID {
+			return true
+		}
+	}
+	return false
+}
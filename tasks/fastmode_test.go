@@ -0,0 +1,59 @@
+package tasks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeSavedMeasuresBaselineScrape(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`<script>const collection = {"id": 1, "products": []}</script>`))
+	}))
+	defer server.Close()
+
+	c := &checkout{
+		monitorCtx:  context.Background(),
+		task:        Task{Site: "baseline-test", VariantID: 1001},
+		productLink: server.URL,
+		log:         taskLogger(0, "baseline-test"),
+		startTime:   time.Now(),
+		sessionTime: 10 * time.Millisecond,
+	}
+	c.baseline = c.startBaselineScrape(c.monitorCtx)
+
+	saved, ok := c.timeSaved()
+	if !ok {
+		t.Fatal("no time saved reported for a lone fast mode task")
+	}
+	if saved < 30*time.Millisecond {
+		t.Errorf("time saved = %v, want the baseline scrape minus the session time", saved)
+	}
+}
+
+func TestParseVariantKeyword(t *testing.T) {
+	for _, tc := range []struct {
+		keyword   string
+		want      int
+		isVariant bool
+		ok        bool
+	}{
+		{"variant:55601083", 55601083, true, true},
+		{"Variant:55601083", 55601083, true, true},
+		{"variant:peakkl:55601083", 55601083, true, true},
+		{"variant:other:55601083", 0, true, false},
+		{"variant:abc", 0, true, false},
+		{"variant:0", 0, true, false},
+		{"55601083", 0, false, true},
+		{"peakkl:55601083", 0, false, true},
+		{"jordan 4", 0, false, true},
+	} {
+		got, isVariant, err := parseVariantKeyword("peakkl", tc.keyword)
+		if (err == nil) != tc.ok || isVariant != tc.isVariant || got != tc.want {
+			t.Errorf("parseVariantKeyword(%q) = %d, %v, %v; want %d, %v, ok %v", tc.keyword, got, isVariant, err, tc.want, tc.isVariant, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package tasks
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const historyTimeFormat = "2006-01-02T15:04:05.000Z"
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at  TEXT NOT NULL,
+	finished_at TEXT,
+	tasks_file  TEXT NOT NULL,
+	task_count  INTEGER NOT NULL,
+	checkouts   INTEGER NOT NULL DEFAULT 0,
+	interrupted INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS attempts (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_id          INTEGER NOT NULL REFERENCES runs(id),
+	task            INTEGER NOT NULL,
+	site            TEXT NOT NULL,
+	keyword         TEXT NOT NULL,
+	size            TEXT NOT NULL,
+	started_at      TEXT NOT NULL,
+	finished_at     TEXT,
+	final_state     TEXT,
+	product_id      INTEGER,
+	product         TEXT,
+	variant_id      INTEGER,
+	variant         TEXT,
+	price           REAL,
+	cart_token      TEXT,
+	shipping_handle TEXT,
+	checkout_url    TEXT,
+	retries         INTEGER NOT NULL DEFAULT 0,
+	error           TEXT,
+	duration_ms     INTEGER,
+	dry_run         INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS transitions (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	attempt_id INTEGER NOT NULL REFERENCES attempts(id),
+	task       INTEGER NOT NULL,
+	site       TEXT NOT NULL,
+	from_state TEXT NOT NULL,
+	to_state   TEXT NOT NULL,
+	attempt    INTEGER NOT NULL,
+	error      TEXT,
+	product    TEXT,
+	variant    TEXT,
+	at         TEXT NOT NULL,
+	elapsed_ms INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS attempts_run ON attempts(run_id);
+CREATE INDEX IF NOT EXISTS attempts_finished ON attempts(finished_at);
+CREATE INDEX IF NOT EXISTS transitions_attempt ON transitions(attempt_id);
+`
+
+var historyTables = map[string]bool{"runs": true, "attempts": true, "transitions": true}
+
+type History struct {
+	db    *sql.DB
+	runID int64
+}
+
+func OpenHistory(path string) (*History, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	for _, pragma := range []string{"PRAGMA journal_mode=WAL", "PRAGMA busy_timeout=5000", "PRAGMA foreign_keys=ON"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error configuring %s: %w", path, err)
+		}
+	}
+
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating history tables in %s: %w", path, err)
+	}
+
+	if err := migrateHistory(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating history in %s: %w", path, err)
+	}
+
+	return &History{db: db}, nil
+}
+
+func migrateHistory(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('attempts')`)
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		columns[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !columns["dry_run"] {
+		if _, err := db.Exec(`ALTER TABLE attempts ADD COLUMN dry_run INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+func historyTime(t time.Time) string {
+	return t.UTC().Format(historyTimeFormat)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func setHistory(h *History) {
+	registry.SetHistory(h)
+}
+
+func currentHistory() *History {
+	return registry.History()
+}
+
+func (h *History) StartRun(tasksFile string, taskCount int) error {
+	result, err := h.db.Exec(`INSERT INTO runs (started_at, tasks_file, task_count) VALUES (?, ?, ?)`,
+		historyTime(time.Now()), tasksFile, taskCount)
+	if err != nil {
+		return fmt.Errorf("error recording run: %w", err)
+	}
+	h.runID, err = result.LastInsertId()
+	return err
+}
+
+func (h *History) FinishRun(checkouts int, interrupted bool) error {
+	_, err := h.db.Exec(`UPDATE runs SET finished_at = ?, checkouts = ?, interrupted = ? WHERE id = ?`,
+		historyTime(time.Now()), checkouts, interrupted, h.runID)
+	if err != nil {
+		return fmt.Errorf("error recording run: %w", err)
+	}
+	return nil
+}
+
+func (h *History) startCheckout(idx int, task Task) int64 {
+	if h == nil {
+		return 0
+	}
+
+	result, err := h.db.Exec(`INSERT INTO attempts (run_id, task, site, keyword, size, started_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		h.runID, idx+1, task.Site, task.Keyword, task.Size, historyTime(time.Now()))
+	if err != nil {
+		taskLogger(idx, task.Site).Warn("Failed to record checkout in history", "err", err)
+		return 0
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+func (h *History) finishCheckout(c *checkout, state State, duration time.Duration) {
+	if h == nil || c.checkoutID == 0 {
+		return
+	}
+
+	var productID, variantID sql.NullInt64
+	var product, variant sql.NullString
+	var price sql.NullFloat64
+	if c.product != nil {
+		productID = sql.NullInt64{Int64: int64(c.product.ID), Valid: c.product.ID != 0}
+		product = nullString(c.product.Name)
+		price = sql.NullFloat64{Float64: c.product.Price, Valid: true}
+	}
+	if c.variant != nil {
+		variantID = sql.NullInt64{Int64: int64(c.variant.ID), Valid: true}
+		variant = nullString(c.variant.Title)
+	}
+	var errText sql.NullString
+	if c.lastErr != nil {
+		errText = nullString(c.lastErr.Error())
+	}
+
+	_, err := h.db.Exec(`UPDATE attempts SET finished_at = ?, final_state = ?, product_id = ?, product = ?, variant_id = ?, variant = ?,
+		price = ?, cart_token = ?, shipping_handle = ?, checkout_url = ?, retries = ?, error = ?, duration_ms = ?, dry_run = ? WHERE id = ?`,
+		historyTime(time.Now()), state.String(), productID, product, variantID, variant,
+		price, nullString(c.cartToken), nullString(c.shippingRate), nullString(c.checkoutLink), c.retries, errText, duration.Milliseconds(), c.dryRun, c.checkoutID)
+	if err != nil {
+		c.log.Warn("Failed to record checkout in history", "err", err)
+	}
+}
+
+func recordTransition(t Transition) {
+	h := currentHistory()
+	if h == nil || t.CheckoutID == 0 {
+		return
+	}
+
+	var errText, product, variant sql.NullString
+	if t.Err != nil {
+		errText = nullString(t.Err.Error())
+	}
+	if t.Product != nil {
+		product = nullString(t.Product.Name)
+	}
+	if t.Variant != nil {
+		variant = nullString(t.Variant.Title)
+	}
+
+	_, err := h.db.Exec(`INSERT INTO transitions (attempt_id, task, site, from_state, to_state, attempt, error, product, variant, at, elapsed_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.CheckoutID, t.Task+1, t.Site, t.From.String(), t.To.String(), t.Attempt, errText, product, variant, historyTime(time.Now()), t.Elapsed.Milliseconds())
+	if err != nil {
+		taskLogger(t.Task, t.Site).Warn("Failed to record transition in history", "err", err)
+	}
+}
+
+type SiteCheckouts struct {
+	Site      string
+	Checkouts int
+	Attempts  int
+}
+
+func (h *History) CheckoutsPerSite(since time.Time) ([]SiteCheckouts, error) {
+	rows, err := h.db.Query(`SELECT site, SUM(final_state = 'Done' AND dry_run = 0), COUNT(*) FROM attempts
+		WHERE started_at >= ? GROUP BY site ORDER BY site`, historyTime(since))
+	if err != nil {
+		return nil, fmt.Errorf("error querying history: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []SiteCheckouts
+	for rows.Next() {
+		var count SiteCheckouts
+		if err := rows.Scan(&count.Site, &count.Checkouts, &count.Attempts); err != nil {
+			return nil, fmt.Errorf("error reading history: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+type TaskFailure struct {
+	RunID      int64
+	Task       int
+	Site       string
+	Product    string
+	FinalState string
+	Error      string
+	FinishedAt time.Time
+}
+
+func (h *History) LastFailures(task int) ([]TaskFailure, error) {
+	query := `SELECT a.run_id, a.task, a.site, COALESCE(a.product, ''), a.final_state, COALESCE(a.error, ''), a.finished_at
+		FROM attempts a
+		WHERE a.id = (SELECT MAX(b.id) FROM attempts b WHERE b.task = a.task AND b.final_state IN ('Failed', 'Canceled'))`
+	args := []interface{}{}
+	if task > 0 {
+		query += ` AND a.task = ?`
+		args = append(args, task)
+	}
+	query += ` ORDER BY a.task`
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying history: %w", err)
+	}
+	defer rows.Close()
+
+	var failures []TaskFailure
+	for rows.Next() {
+		var failure TaskFailure
+		var finishedAt string
+		if err := rows.Scan(&failure.RunID, &failure.Task, &failure.Site, &failure.Product, &failure.FinalState, &failure.Error, &finishedAt); err != nil {
+			return nil, fmt.Errorf("error reading history: %w", err)
+		}
+		failure.FinishedAt, _ = time.Parse(historyTimeFormat, finishedAt)
+		failures = append(failures, failure)
+	}
+	return failures, rows.Err()
+}
+
+type RunSummary struct {
+	ID          int64
+	StartedAt   time.Time
+	Duration    time.Duration
+	TasksFile   string
+	Tasks       int
+	Checkouts   int
+	Interrupted bool
+}
+
+func (h *History) Runs(limit int) ([]RunSummary, error) {
+	rows, err := h.db.Query(`SELECT id, started_at, COALESCE(finished_at, ''), tasks_file, task_count, checkouts, interrupted
+		FROM runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying history: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []RunSummary
+	for rows.Next() {
+		var run RunSummary
+		var startedAt, finishedAt string
+		if err := rows.Scan(&run.ID, &startedAt, &finishedAt, &run.TasksFile, &run.Tasks, &run.Checkouts, &run.Interrupted); err != nil {
+			return nil, fmt.Errorf("error reading history: %w", err)
+		}
+		run.StartedAt, _ = time.Parse(historyTimeFormat, startedAt)
+		if finished, err := time.Parse(historyTimeFormat, finishedAt); err == nil {
+			run.Duration = finished.Sub(run.StartedAt)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (h *History) Export(w io.Writer, table string, format string) error {
+	if !historyTables[table] {
+		return fmt.Errorf("unknown table %q, expected runs, attempts or transitions", table)
+	}
+
+	rows, err := h.db.Query(fmt.Sprintf(`SELECT * FROM %s ORDER BY id`, table))
+	if err != nil {
+		return fmt.Errorf("error querying history: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	var records [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return fmt.Errorf("error reading history: %w", err)
+		}
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		records = append(records, values)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(format) {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		for _, values := range records {
+			record := make([]string, len(values))
+			for i, value := range values {
+				if value != nil {
+					record[i] = fmt.Sprint(value)
+				}
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		objects := make([]map[string]interface{}, 0, len(records))
+		for _, values := range records {
+			object := make(map[string]interface{}, len(columns))
+			for i, column := range columns {
+				object[column] = values[i]
+			}
+			objects = append(objects, object)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(objects)
+	default:
+		return fmt.Errorf("unknown format %q, expected csv or json", format)
+	}
+}
@@ -0,0 +1,238 @@
+package tasks
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestHistory(t *testing.T) *History {
+	t.Helper()
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func historyColumns(t *testing.T, db *sql.DB, table string) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+func TestOpenHistoryCreatesSchema(t *testing.T) {
+	h := openTestHistory(t)
+	for table := range historyTables {
+		if columns := historyColumns(t, h.db, table); len(columns) == 0 {
+			t.Errorf("table %s was not created", table)
+		}
+	}
+}
+
+func TestMigrateHistoryAddsDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE attempts (id INTEGER PRIMARY KEY AUTOINCREMENT, run_id INTEGER NOT NULL, task INTEGER NOT NULL,
+		site TEXT NOT NULL, keyword TEXT NOT NULL, size TEXT NOT NULL, started_at TEXT NOT NULL, finished_at TEXT, final_state TEXT)`)
+	if err == nil {
+		_, err = db.Exec(`INSERT INTO attempts (run_id, task, site, keyword, size, started_at, final_state) VALUES (1, 1, 'peakkl', 'dunk', 'M', ?, 'Done')`,
+			historyTime(time.Now()))
+	}
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		h, err := OpenHistory(path)
+		if err != nil {
+			t.Fatalf("open %d: %v", i+1, err)
+		}
+		columns := strings.Join(historyColumns(t, h.db, "attempts"), ",")
+		if !strings.HasSuffix(columns, ",dry_run") {
+			t.Errorf("open %d: attempts columns = %s, want dry_run added", i+1, columns)
+		}
+		var dryRun int
+		if err := h.db.QueryRow(`SELECT dry_run FROM attempts WHERE id = 1`).Scan(&dryRun); err != nil || dryRun != 0 {
+			t.Errorf("open %d: old attempt dry_run = %d, %v, want 0", i+1, dryRun, err)
+		}
+		h.Close()
+	}
+}
+
+func recordTestCheckout(h *History, idx int, site string, state State, dryRun bool, err error) {
+	c := &checkout{
+		log:       taskLogger(idx, site),
+		product:   &ProductDetail{ID: 7, Name: "Dunk Low", Price: 459},
+		variant:   &Variant{ID: 70, Title: "UK 9"},
+		lastErr:   err,
+		dryRun:    dryRun,
+		cartToken: "cart",
+	}
+	c.checkoutID = h.startCheckout(idx, Task{Site: site, Keyword: "dunk", Size: "UK 9"})
+	h.finishCheckout(c, state, time.Second)
+}
+
+func TestHistoryQueries(t *testing.T) {
+	h := openTestHistory(t)
+	if err := h.StartRun("Tasks.csv", 3); err != nil {
+		t.Fatal(err)
+	}
+	_, err := h.db.Exec(`INSERT INTO attempts (run_id, task, site, keyword, size, started_at, final_state) VALUES (?, 1, 'peakkl', 'dunk', 'M', ?, 'Done')`,
+		h.runID, historyTime(time.Now().Add(-48*time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordTestCheckout(h, 0, "peakkl", StateFailed, false, errors.New("card declined"))
+	recordTestCheckout(h, 0, "peakkl", StateDone, false, nil)
+	recordTestCheckout(h, 1, "peakkl", StateDone, true, nil)
+	recordTestCheckout(h, 1, "opt", StateCanceled, false, errors.New("context canceled"))
+	recordTestCheckout(h, 1, "opt", StateFailed, false, errors.New("out of stock"))
+	recordTestCheckout(h, 2, "opt", StateDone, false, nil)
+	if err := h.FinishRun(2, false); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := h.CheckoutsPerSite(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SiteCheckouts{{Site: "opt", Checkouts: 1, Attempts: 3}, {Site: "peakkl", Checkouts: 1, Attempts: 3}}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("CheckoutsPerSite(1h) = %+v, want %+v", counts, want)
+	}
+	counts, err = h.CheckoutsPerSite(time.Now().Add(-72 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[1].Checkouts != 2 || counts[1].Attempts != 4 {
+		t.Errorf("CheckoutsPerSite(72h) = %+v, want the older peakkl checkout included", counts)
+	}
+
+	failures, err := h.LastFailures(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 2 {
+		t.Fatalf("LastFailures(0) = %+v, want tasks 1 and 2", failures)
+	}
+	if f := failures[0]; f.Task != 1 || f.FinalState != "Failed" || f.Error != "card declined" || f.Product != "Dunk Low" || f.FinishedAt.IsZero() {
+		t.Errorf("task 1 failure = %+v", f)
+	}
+	if f := failures[1]; f.Task != 2 || f.Site != "opt" || f.Error != "out of stock" {
+		t.Errorf("task 2 failure = %+v, want the latest one", f)
+	}
+
+	failures, err = h.LastFailures(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Task != 2 {
+		t.Errorf("LastFailures(2) = %+v, want only task 2", failures)
+	}
+	if failures, err := h.LastFailures(3); err != nil || len(failures) != 0 {
+		t.Errorf("LastFailures(3) = %+v, %v, want none", failures, err)
+	}
+
+	runs, err := h.Runs(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Tasks != 3 || runs[0].Checkouts != 2 || runs[0].Interrupted {
+		t.Errorf("Runs = %+v", runs)
+	}
+}
+
+func TestHistoryExport(t *testing.T) {
+	h := openTestHistory(t)
+	if err := h.StartRun("Tasks.csv", 1); err != nil {
+		t.Fatal(err)
+	}
+	recordTestCheckout(h, 0, "peakkl", StateDone, false, nil)
+	recordTestCheckout(h, 0, "peakkl", StateFailed, false, errors.New("card, declined"))
+
+	var out strings.Builder
+	if err := h.Export(&out, "attempts", "CSV"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("CSV export has %d records, want a header and 2 rows", len(records))
+	}
+	header := records[0]
+	column := func(name string) int {
+		for i, heading := range header {
+			if heading == name {
+				return i
+			}
+		}
+		t.Fatalf("CSV header %v has no %s column", header, name)
+		return -1
+	}
+	if got := records[2][column("error")]; got != "card, declined" {
+		t.Errorf("CSV error = %q", got)
+	}
+	if got := records[1][column("error")]; got != "" {
+		t.Errorf("CSV error for a NULL = %q, want empty", got)
+	}
+	if got := records[1][column("product")]; got != "Dunk Low" {
+		t.Errorf("CSV product = %q", got)
+	}
+
+	out.Reset()
+	if err := h.Export(&out, "attempts", "json"); err != nil {
+		t.Fatal(err)
+	}
+	var objects []map[string]interface{}
+	if err := json.Unmarshal([]byte(out.String()), &objects); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("JSON export has %d objects, want 2", len(objects))
+	}
+	if objects[0]["final_state"] != "Done" || objects[0]["error"] != nil || objects[1]["price"] != 459.0 {
+		t.Errorf("JSON export = %+v", objects)
+	}
+
+	out.Reset()
+	if err := h.Export(&out, "runs", "json"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"tasks_file": "Tasks.csv"`) {
+		t.Errorf("runs export = %s", out.String())
+	}
+
+	if err := h.Export(&out, "sqlite_master", "csv"); err == nil {
+		t.Error("Export of an unknown table succeeded")
+	}
+	if err := h.Export(&out, "attempts", "xml"); err == nil {
+		t.Error("Export in an unknown format succeeded")
+	}
+}
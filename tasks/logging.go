@@ -0,0 +1,543 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+type LogOptions struct {
+	Level      slog.Level
+	Format     string
+	Dir        string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+func DefaultLogOptions() LogOptions {
+	return LogOptions{Level: slog.LevelInfo, Format: LogFormatConsole, Dir: "logs", MaxSizeMB: 5, MaxBackups: 3}
+}
+
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+var (
+	logOutput  = &switchWriter{w: os.Stdout}
+	loggerMu   sync.RWMutex
+	logger     = slog.New(redactHandler{newConsoleHandler(logOutput, slog.LevelInfo, false)})
+	taskWriter *taskFiles
+)
+
+func SetLogOutput(w io.Writer) (restore func()) {
+	logOutput.mu.Lock()
+	defer logOutput.mu.Unlock()
+	previous := logOutput.w
+	logOutput.w = w
+	return func() {
+		logOutput.mu.Lock()
+		defer logOutput.mu.Unlock()
+		logOutput.w = previous
+	}
+}
+
+func SetupLogging(opts LogOptions) error {
+	var handler slog.Handler
+	switch opts.Format {
+	case LogFormatConsole, "":
+		handler = newConsoleHandler(logOutput, opts.Level, colorEnabled(os.Stdout))
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(logOutput, &slog.HandlerOptions{Level: opts.Level, ReplaceAttr: jsonDurations})
+	default:
+		return fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	var files *taskFiles
+	if opts.Dir != "" {
+		files = &taskFiles{dir: opts.Dir, maxSize: int64(opts.MaxSizeMB) << 20, maxBackups: opts.MaxBackups, files: make(map[int64]*rotatingFile)}
+		handler = fanoutHandler{handler, &taskFileHandler{files: files, level: opts.Level, handlers: &sync.Map{}}}
+	}
+
+	loggerMu.Lock()
+	previous := taskWriter
+	logger = slog.New(redactHandler{handler})
+	taskWriter = files
+	loggerMu.Unlock()
+
+	if previous != nil {
+		previous.close()
+	}
+	return nil
+}
+
+func CloseLogs() {
+	loggerMu.Lock()
+	files := taskWriter
+	taskWriter = nil
+	loggerMu.Unlock()
+
+	if files != nil {
+		files.close()
+	}
+}
+
+func Logger() *slog.Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+func taskLogger(idx int, site string) *slog.Logger {
+	return Logger().With("task", idx+1, "site", site)
+}
+
+func colorEnabled(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(f.Fd()))
+}
+
+func jsonDurations(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindDuration {
+		return slog.String(a.Key, a.Value.Duration().Round(time.Millisecond).String())
+	}
+	return a
+}
+
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return redactHandler{h.Handler.WithAttrs(redacted)}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.Handler.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	if column, ok := secretKey(a.Key); ok && a.Value.Kind() != slog.KindGroup && redactionEnabled() {
+		return slog.String(a.Key, redactValue(column, a.Value.String()))
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok && err != nil {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+	return a
+}
+
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, handler := range h {
+		if !handler.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := handler.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
+
+const (
+	ansiReset  = "\033[0m"
+	ansiGray   = "\033[90m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiCyan   = "\033[36m"
+)
+
+var prefixKeys = []string{"task", "site", "state"}
+
+type consoleHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	color  bool
+	attrs  []slog.Attr
+	groups string
+}
+
+func newConsoleHandler(w io.Writer, level slog.Leveler, color bool) *consoleHandler {
+	return &consoleHandler{mu: &sync.Mutex{}, w: w, level: level, color: color}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr(nil), h.attrs...), h.qualify(attrs)...)
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.groups = h.groups + name + "."
+	return &clone
+}
+
+func (h *consoleHandler) qualify(attrs []slog.Attr) []slog.Attr {
+	if h.groups == "" {
+		return attrs
+	}
+	qualified := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		qualified[i] = slog.Attr{Key: h.groups + a.Key, Value: a.Value}
+	}
+	return qualified
+}
+
+func (h *consoleHandler) paint(color string, text string) string {
+	if !h.color || text == "" {
+		return text
+	}
+	return color + text + ansiReset
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := append([]slog.Attr(nil), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, h.qualify([]slog.Attr{a})...)
+		return true
+	})
+
+	prefix := make(map[string]string)
+	var fields []string
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			continue
+		}
+		value := formatLogValue(a.Value)
+		if isPrefixKey(a.Key) {
+			prefix[a.Key] = value
+			continue
+		}
+		fields = append(fields, h.paint(ansiGray, a.Key+"=")+value)
+	}
+
+	var b strings.Builder
+	b.WriteString(h.paint(ansiGray, r.Time.Format("15:04:05.000")))
+	b.WriteByte(' ')
+	b.WriteString(h.levelLabel(r.Level))
+	b.WriteByte(' ')
+	if task, ok := prefix["task"]; ok {
+		b.WriteString(h.paint(ansiCyan, "[Task "+task+"]"))
+	}
+	for _, key := range prefixKeys[1:] {
+		if value, ok := prefix[key]; ok {
+			b.WriteString(h.paint(ansiCyan, "["+value+"]"))
+		}
+	}
+	if len(prefix) > 0 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(r.Message)
+	for _, field := range fields {
+		b.WriteByte(' ')
+		b.WriteString(field)
+	}
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *consoleHandler) levelLabel(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return h.paint(ansiRed, "ERROR")
+	case level >= slog.LevelWarn:
+		return h.paint(ansiYellow, "WARN ")
+	case level >= slog.LevelInfo:
+		return h.paint(ansiGreen, "INFO ")
+	default:
+		return h.paint(ansiGray, "DEBUG")
+	}
+}
+
+func isPrefixKey(key string) bool {
+	for _, prefixKey := range prefixKeys {
+		if key == prefixKey {
+			return true
+		}
+	}
+	return false
+}
+
+func formatLogValue(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().Round(time.Millisecond).String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339)
+	case slog.KindString:
+		s := v.String()
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			return strconv.Quote(s)
+		}
+		return s
+	default:
+		return v.String()
+	}
+}
+
+type taskFileHandler struct {
+	files    *taskFiles
+	level    slog.Leveler
+	task     int64
+	attrs    []slog.Attr
+	groups   []string
+	handlers *sync.Map
+}
+
+func (h *taskFileHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *taskFileHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	if len(h.groups) == 0 {
+		for _, a := range attrs {
+			if a.Key == "task" && a.Value.Kind() == slog.KindInt64 {
+				clone.task = a.Value.Int64()
+			}
+		}
+	}
+	clone.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	clone.handlers = &sync.Map{}
+	return &clone
+}
+
+func (h *taskFileHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.groups = append(append([]string(nil), h.groups...), name)
+	clone.handlers = &sync.Map{}
+	return &clone
+}
+
+func (h *taskFileHandler) Handle(ctx context.Context, r slog.Record) error {
+	task := h.task
+	if task == 0 && len(h.groups) == 0 {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "task" && a.Value.Kind() == slog.KindInt64 {
+				task = a.Value.Int64()
+				return false
+			}
+			return true
+		})
+	}
+	if task == 0 {
+		return nil
+	}
+
+	file, err := h.files.get(task)
+	if err != nil {
+		return err
+	}
+
+	if handler, ok := h.handlers.Load(file); ok {
+		return handler.(slog.Handler).Handle(ctx, r)
+	}
+
+	handler := file.handler
+	if len(h.attrs) > 0 {
+		handler = handler.WithAttrs(h.attrs)
+	}
+	for _, group := range h.groups {
+		handler = handler.WithGroup(group)
+	}
+	h.handlers.Store(file, handler)
+	return handler.Handle(ctx, r)
+}
+
+type taskFiles struct {
+	mu         sync.Mutex
+	dir        string
+	maxSize    int64
+	maxBackups int
+	files      map[int64]*rotatingFile
+}
+
+func (t *taskFiles) get(task int64) (*rotatingFile, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if file, ok := t.files[task]; ok {
+		return file, nil
+	}
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating log directory %s: %w", t.dir, err)
+	}
+	file, err := openRotatingFile(filepath.Join(t.dir, fmt.Sprintf("task-%d.log", task)), t.maxSize, t.maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	t.files[task] = file
+	return file, nil
+}
+
+func (t *taskFiles) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for task, file := range t.files {
+		file.Close()
+		delete(t.files, task)
+	}
+}
+
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	handler    slog.Handler
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.handler = slog.NewJSONHandler(r, &slog.HandlerOptions{ReplaceAttr: jsonDurations})
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening %s file: %w", r.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error opening %s file: %w", r.path, err)
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	r.file = nil
+
+	if r.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+		for i := r.maxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return fmt.Errorf("error rotating %s: %w", r.path, err)
+		}
+	} else if err := os.Truncate(r.path, 0); err != nil {
+		return fmt.Errorf("error rotating %s: %w", r.path, err)
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
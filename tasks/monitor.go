@@ -0,0 +1,259 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Snapshot struct {
+	Site         string
+	URL          string
+	IsDirectLink bool
+	Collection   *Collection
+	Product      *Product
+	Events       []StockEvent
+	FetchedAt    time.Time
+	Err          error
+	Transient    bool
+}
+
+const maxPendingEvents = 256
+
+type monitorKey struct {
+	site         string
+	url          string
+	isDirectLink bool
+	proxyGroup   string
+}
+
+type MonitorPool struct {
+	mu       sync.Mutex
+	monitors map[monitorKey]*productMonitor
+}
+
+func NewMonitorPool() *MonitorPool {
+	return &MonitorPool{monitors: make(map[monitorKey]*productMonitor)}
+}
+
+type Subscription struct {
+	C      <-chan Snapshot
+	cancel func()
+}
+
+func (s *Subscription) Close() {
+	s.cancel()
+}
+
+func (s *Subscription) drain() {
+	select {
+	case <-s.C:
+	default:
+	}
+}
+
+func (p *MonitorPool) Subscribe(site string, url string, isDirectLink bool, proxyGroup string, delay time.Duration) *Subscription {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proxyGroup = GetMonitorProxyGroup(proxyGroup)
+	key := monitorKey{site: site, url: url, isDirectLink: isDirectLink, proxyGroup: proxyGroup}
+	m, ok := p.monitors[key]
+	if !ok {
+		m = newProductMonitor(site, url, isDirectLink, proxyGroup)
+		p.monitors[key] = m
+	}
+
+	id, ch := m.subscribe(delay)
+	if !ok {
+		go m.run()
+	}
+
+	return &Subscription{
+		C: ch,
+		cancel: func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if m.unsubscribe(id) == 0 {
+				m.cancel()
+				delete(p.monitors, key)
+			}
+		},
+	}
+}
+
+type subscriber struct {
+	ch    chan Snapshot
+	delay time.Duration
+}
+
+type productMonitor struct {
+	site         string
+	url          string
+	isDirectLink bool
+	client       *http.Client
+	ctx          context.Context
+	cancel       context.CancelFunc
+	previous     *Collection
+
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]subscriber
+}
+
+func newProductMonitor(site string, url string, isDirectLink bool, proxyGroup string) *productMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := newHTTPClient(nil)
+	if proxyGroup != "" {
+		client = newRotatingHTTPClient(proxyGroup)
+	}
+	return &productMonitor{
+		site:         site,
+		url:          url,
+		isDirectLink: isDirectLink,
+		client:       client,
+		ctx:          ctx,
+		cancel:       cancel,
+		subscribers:  make(map[int]subscriber),
+	}
+}
+
+func (m *productMonitor) subscribe(delay time.Duration) (int, chan Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	ch := make(chan Snapshot, 1)
+	m.subscribers[m.nextID] = subscriber{ch: ch, delay: delay}
+	return m.nextID, ch
+}
+
+func (m *productMonitor) unsubscribe(id int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.subscribers, id)
+	return len(m.subscribers)
+}
+
+func (m *productMonitor) interval() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var interval time.Duration
+	first := true
+	for _, sub := range m.subscribers {
+		if first || sub.delay < interval {
+			interval = sub.delay
+			first = false
+		}
+	}
+	return interval
+}
+
+func (m *productMonitor) run() {
+	for {
+		snapshot := m.poll()
+		if m.ctx.Err() != nil {
+			return
+		}
+		m.broadcast(snapshot)
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(m.interval()):
+		}
+	}
+}
+
+func (m *productMonitor) broadcast(snapshot Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sub := range m.subscribers {
+		next := snapshot
+		select {
+		case unread := <-sub.ch:
+			next.Events = carryEvents(unread.Events, snapshot.Events)
+		default:
+		}
+		sub.ch <- next
+	}
+}
+
+func carryEvents(unread []StockEvent, events []StockEvent) []StockEvent {
+	if len(unread) == 0 {
+		return events
+	}
+	merged := append(append([]StockEvent(nil), unread...), events...)
+	if len(merged) > maxPendingEvents {
+		merged = merged[len(merged)-maxPendingEvents:]
+	}
+	return merged
+}
+
+func (m *productMonitor) poll() Snapshot {
+	snapshot := Snapshot{
+		Site:         m.site,
+		URL:          m.url,
+		IsDirectLink: m.isDirectLink,
+		FetchedAt:    time.Now(),
+	}
+
+	start := time.Now()
+	htmlContent, resp, err := fetchHTML(m.ctx, m.url, m.client)
+	if err != nil {
+		if resp != nil {
+			Logger().Debug("Product not loaded yet", "site", m.site, "url", m.url)
+		} else {
+			Logger().Warn("Failed to fetch HTML content", "site", m.site, "url", m.url, "err", err)
+		}
+		snapshot.Err = err
+		snapshot.Transient = true
+		return snapshot
+	}
+
+	scriptContent, err := extractJavaScript(htmlContent, m.isDirectLink)
+	if err != nil {
+		snapshot.Err = fmt.Errorf("failed to find JavaScript object for site %s: %w", m.site, err)
+		return snapshot
+	}
+
+	if m.isDirectLink {
+		var product Product
+		if err := json.Unmarshal([]byte(scriptContent), &product); err != nil {
+			snapshot.Err = fmt.Errorf("failed to unmarshal JSON for site %s: %w", m.site, err)
+			return snapshot
+		}
+		snapshot.Product = &product
+	} else {
+		var collection Collection
+		if err := json.Unmarshal([]byte(scriptContent), &collection); err != nil {
+			snapshot.Err = fmt.Errorf("failed to unmarshal JSON for site %s: %w", m.site, err)
+			return snapshot
+		}
+		snapshot.Collection = &collection
+	}
+
+	if !m.isDirectLink {
+		recordScrapeTime(m.site, time.Since(start))
+	}
+
+	current := snapshot.Collection
+	if current == nil {
+		current = &Collection{Products: []Product{*snapshot.Product}}
+	}
+	snapshot.Events = DiffCollections(m.site, m.previous, current)
+	m.previous = current
+
+	return snapshot
+}
+
+func isDirectLink(keyword string) bool {
+	return strings.HasPrefix(keyword, "https://") || strings.HasPrefix(keyword, "http://")
+}
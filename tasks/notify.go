@@ -0,0 +1,445 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const notifyQueueSize = 256
+
+type NotificationKind string
+
+const (
+	NotifyCheckout NotificationKind = "checkout"
+	NotifyFailure  NotificationKind = "failure"
+	NotifyRestock  NotificationKind = "restock"
+	NotifyStock    NotificationKind = "stock"
+)
+
+var notificationKinds = map[NotificationKind]bool{
+	NotifyCheckout: true,
+	NotifyFailure:  true,
+	NotifyRestock:  true,
+	NotifyStock:    true,
+}
+
+type Notification struct {
+	Kind         NotificationKind `json:"kind"`
+	Task         int              `json:"task,omitempty"`
+	Site         string           `json:"site"`
+	Country      string           `json:"country,omitempty"`
+	Product      string           `json:"product"`
+	Variant      string           `json:"variant,omitempty"`
+	Price        float64          `json:"price"`
+	ImageURL     string           `json:"image_url,omitempty"`
+	ProductURL   string           `json:"product_url,omitempty"`
+	CheckoutLink string           `json:"checkout_link,omitempty"`
+	DryRun       bool             `json:"dry_run,omitempty"`
+	Error        string           `json:"error,omitempty"`
+	Event        *StockEvent      `json:"-"`
+	At           time.Time        `json:"at"`
+}
+
+func (n Notification) Title() string {
+	switch n.Kind {
+	case NotifyCheckout:
+		if n.DryRun {
+			return "Dry Run: Order Not Placed"
+		}
+		return "Checkout Success"
+	case NotifyFailure:
+		return "Checkout Failed!"
+	default:
+		if n.Event != nil {
+			return fmt.Sprintf("%s: %s", n.Event.Kind, n.Product)
+		}
+		return n.Product
+	}
+}
+
+func (n Notification) Lines() []string {
+	var lines []string
+	if n.Event != nil {
+		lines = append(lines, n.Event.String())
+	} else {
+		lines = append(lines, fmt.Sprintf("Product: %s", n.Product), fmt.Sprintf("Variant: %s", n.Variant))
+	}
+	lines = append(lines, fmt.Sprintf("Site: %s", n.Site))
+	if n.Country != "" {
+		lines = append(lines, fmt.Sprintf("Country: %s", n.Country))
+	}
+	lines = append(lines, fmt.Sprintf("Price: %.2f", n.Price))
+	if n.Task > 0 {
+		lines = append(lines, fmt.Sprintf("Task No: %d", n.Task))
+	}
+	if n.CheckoutLink != "" {
+		lines = append(lines, fmt.Sprintf("Checkout Link: %s", n.CheckoutLink))
+	}
+	if n.DryRun {
+		lines = append(lines, "Dry Run: stopped before order placement, no order was created")
+	}
+	if n.ProductURL != "" {
+		lines = append(lines, n.ProductURL)
+	}
+	if n.Error != "" {
+		lines = append(lines, fmt.Sprintf("Error: %s", n.Error))
+	}
+	return lines
+}
+
+func checkoutNotification(t Transition) Notification {
+	n := Notification{
+		Kind:         NotifyCheckout,
+		Task:         t.Task + 1,
+		Site:         t.Site,
+		Country:      t.Country,
+		Product:      t.Product.Name,
+		Variant:      t.Variant.Title,
+		Price:        t.Product.Price,
+		ImageURL:     t.Product.ImgUrl,
+		CheckoutLink: t.CheckoutLink,
+		DryRun:       t.DryRun,
+		At:           time.Now(),
+	}
+	if t.To != StateDone {
+		n.Kind = NotifyFailure
+		if t.Err != nil {
+			n.Error = t.Err.Error()
+		}
+	}
+	return n
+}
+
+func stockNotification(event StockEvent) Notification {
+	n := Notification{
+		Kind:       NotifyStock,
+		Site:       event.Site,
+		Product:    event.Product.Name,
+		Price:      event.Product.Price,
+		ImageURL:   event.Product.ImgURL,
+		ProductURL: event.Product.URL,
+		Event:      &event,
+		At:         event.At,
+	}
+	if event.Kind.Restock() {
+		n.Kind = NotifyRestock
+	}
+	if event.Variant != nil {
+		n.Variant = event.Variant.Title
+	}
+	return n
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+type NotifierConfig struct {
+	Type    string            `json:"Type"`
+	URL     string            `json:"URL"`
+	Token   string            `json:"Token"`
+	ChatID  string            `json:"ChatID"`
+	Headers map[string]string `json:"Headers"`
+	Events  []string          `json:"Events"`
+}
+
+type notifierEntry struct {
+	name     string
+	notifier Notifier
+	events   map[NotificationKind]bool
+}
+
+func (e notifierEntry) wants(kind NotificationKind) bool {
+	return len(e.events) == 0 || e.events[kind]
+}
+
+func buildNotifiers(cfg Config) ([]notifierEntry, error) {
+	var entries []notifierEntry
+	if cfg.DiscordWebhook != "" {
+		entries = append(entries, notifierEntry{name: "discord", notifier: NewDiscordNotifier(cfg.DiscordWebhook)})
+	}
+
+	for i, nc := range cfg.Notifiers {
+		notifier, err := newNotifier(nc)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %d: %w", i+1, err)
+		}
+
+		events := make(map[NotificationKind]bool)
+		for _, event := range nc.Events {
+			kind := NotificationKind(strings.ToLower(event))
+			if !notificationKinds[kind] {
+				return nil, fmt.Errorf("notifier %d: unknown event %q", i+1, event)
+			}
+			events[kind] = true
+		}
+		entries = append(entries, notifierEntry{name: strings.ToLower(nc.Type), notifier: notifier, events: events})
+	}
+
+	return entries, nil
+}
+
+func newNotifier(nc NotifierConfig) (Notifier, error) {
+	switch strings.ToLower(nc.Type) {
+	case "discord":
+		if nc.URL == "" {
+			return nil, fmt.Errorf("discord notifier needs a URL")
+		}
+		return NewDiscordNotifier(nc.URL), nil
+	case "slack":
+		if nc.URL == "" {
+			return nil, fmt.Errorf("slack notifier needs a URL")
+		}
+		return NewSlackNotifier(nc.URL), nil
+	case "telegram":
+		if nc.Token == "" || nc.ChatID == "" {
+			return nil, fmt.Errorf("telegram notifier needs a Token and ChatID")
+		}
+		return NewTelegramNotifier(nc.URL, nc.Token, nc.ChatID), nil
+	case "webhook":
+		if nc.URL == "" {
+			return nil, fmt.Errorf("webhook notifier needs a URL")
+		}
+		return NewWebhookNotifier(nc.URL, nc.Headers), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", nc.Type)
+	}
+}
+
+func setNotifiers(entries []notifierEntry) {
+	registry.setNotifiers(entries)
+}
+
+func notify(n Notification) {
+	entries := registry.activeNotifiers()
+
+	n.Error = Redact(n.Error)
+
+	for _, entry := range entries {
+		if !entry.wants(n.Kind) {
+			continue
+		}
+		if !registry.NotifyQueue().enqueue(entry, n) {
+			Logger().Warn("Notification dropped, too many are waiting to be sent", "site", n.Site, "notifier", entry.name)
+		}
+	}
+}
+
+type notifyJob struct {
+	entry notifierEntry
+	n     Notification
+}
+
+type NotifyQueue struct {
+	jobs      chan notifyJob
+	startOnce sync.Once
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func NewNotifyQueue() *NotifyQueue {
+	q := &NotifyQueue{jobs: make(chan notifyJob, notifyQueueSize)}
+	q.idle = sync.NewCond(&q.mu)
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	return q
+}
+
+func (q *NotifyQueue) enqueue(entry notifierEntry, n Notification) bool {
+	q.startOnce.Do(func() { go q.run() })
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.jobs <- notifyJob{entry: entry, n: n}:
+		q.pending++
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *NotifyQueue) context() context.Context {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.ctx
+}
+
+func (q *NotifyQueue) run() {
+	for job := range q.jobs {
+		if err := job.entry.notifier.Notify(q.context(), job.n); err != nil {
+			Logger().Warn("Notification failed", "site", job.n.Site, "notifier", job.entry.name, "err", err)
+		}
+
+		q.mu.Lock()
+		q.pending--
+		if q.pending == 0 {
+			q.idle.Broadcast()
+		}
+		q.mu.Unlock()
+	}
+}
+
+func (q *NotifyQueue) Flush(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		q.mu.Lock()
+		for q.pending > 0 {
+			q.idle.Wait()
+		}
+		q.mu.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+	}
+
+	q.mu.Lock()
+	q.cancel()
+	q.mu.Unlock()
+	<-done
+
+	q.mu.Lock()
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	q.mu.Unlock()
+	return false
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}, headers map[string]string) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create POST request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send POST request: %w", err)
+	}
+	return resp, nil
+}
+
+func expectStatus(resp *http.Response, action string, ok ...int) error {
+	defer resp.Body.Close()
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+	}
+	return newStatusError(action, resp)
+}
+
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{WebhookURL: webhookURL, Client: &http.Client{Timeout: GetRequestTimeout()}}
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	text := fmt.Sprintf("*%s*\n%s", n.Title(), strings.Join(n.Lines(), "\n"))
+	resp, err := postJSON(ctx, s.Client, s.WebhookURL, map[string]string{"text": text}, nil)
+	if err != nil {
+		return err
+	}
+	return expectStatus(resp, "post to Slack", http.StatusOK)
+}
+
+const defaultTelegramAPI = "https://api.telegram.org"
+
+type TelegramNotifier struct {
+	APIURL string
+	Token  string
+	ChatID string
+	Client *http.Client
+}
+
+func NewTelegramNotifier(apiURL string, token string, chatID string) *TelegramNotifier {
+	if apiURL == "" {
+		apiURL = defaultTelegramAPI
+	}
+	return &TelegramNotifier{APIURL: strings.TrimRight(apiURL, "/"), Token: token, ChatID: chatID, Client: &http.Client{Timeout: GetRequestTimeout()}}
+}
+
+func (t *TelegramNotifier) Notify(ctx context.Context, n Notification) error {
+	payload := map[string]interface{}{
+		"chat_id":                  t.ChatID,
+		"text":                     fmt.Sprintf("%s\n%s", n.Title(), strings.Join(n.Lines(), "\n")),
+		"disable_web_page_preview": true,
+	}
+	resp, err := postJSON(ctx, t.Client, fmt.Sprintf("%s/bot%s/sendMessage", t.APIURL, t.Token), payload, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return expectStatus(resp, "send Telegram message", http.StatusOK)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode Telegram response: %w", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram rejected message: %s", result.Description)
+	}
+	return nil
+}
+
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func NewWebhookNotifier(url string, headers map[string]string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Headers: headers, Client: &http.Client{Timeout: GetRequestTimeout()}}
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	payload := struct {
+		Notification
+		Event string `json:"event,omitempty"`
+	}{Notification: n}
+	if n.Event != nil {
+		payload.Event = n.Event.Kind.String()
+	}
+
+	resp, err := postJSON(ctx, w.Client, w.URL, payload, w.Headers)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil
+	}
+	return expectStatus(resp, "post webhook")
+}
@@ -0,0 +1,375 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedRequest struct {
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+type recorder struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+func newRecorder(t *testing.T, respond func(w http.ResponseWriter, attempt int)) *recorder {
+	t.Helper()
+	r := &recorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, recordedRequest{Path: req.URL.Path, Header: req.Header.Clone(), Body: body})
+		attempt := len(r.requests)
+		r.mu.Unlock()
+		if respond != nil {
+			respond(w, attempt)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *recorder) received() []recordedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]recordedRequest(nil), r.requests...)
+}
+
+func (r *recorder) only(t *testing.T) recordedRequest {
+	t.Helper()
+	requests := r.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	return requests[0]
+}
+
+func testCheckout() Notification {
+	return Notification{
+		Kind:         NotifyCheckout,
+		Task:         3,
+		Site:         "peakkl",
+		Country:      "MY",
+		Product:      "Peak Tee",
+		Variant:      "M",
+		Price:        59,
+		CheckoutLink: "https://peak.example/checkout/abc",
+		At:           time.Now(),
+	}
+}
+
+func testRestock() Notification {
+	variant := Variant{ID: 1001, Title: "M"}
+	return stockNotification(StockEvent{
+		Kind:         EventVariantRestocked,
+		Site:         "peakkl",
+		Product:      Product{ID: 100, Name: "Peak Tee", Price: 59, URL: "https://peak.example/products/peak-tee"},
+		Variant:      &variant,
+		NewInventory: 4,
+		At:           time.Now(),
+	})
+}
+
+func TestSlackNotifierPayload(t *testing.T) {
+	server := newRecorder(t, nil)
+
+	if err := NewSlackNotifier(server.URL).Notify(context.Background(), testCheckout()); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload map[string]string
+	if err := json.Unmarshal(server.only(t).Body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"*Checkout Success*", "Product: Peak Tee", "Variant: M", "Country: MY", "Task No: 3", "Checkout Link: https://peak.example/checkout/abc"} {
+		if !strings.Contains(payload["text"], want) {
+			t.Errorf("text %q does not contain %q", payload["text"], want)
+		}
+	}
+}
+
+func TestSlackNotifierError(t *testing.T) {
+	server := newRecorder(t, func(w http.ResponseWriter, _ int) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	})
+
+	err := NewSlackNotifier(server.URL).Notify(context.Background(), testCheckout())
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("err = %v, want a 403 status error", err)
+	}
+}
+
+func TestTelegramNotifierPayload(t *testing.T) {
+	server := newRecorder(t, func(w http.ResponseWriter, _ int) {
+		w.Write([]byte(`{"ok":true}`))
+	})
+
+	notifier := NewTelegramNotifier(server.URL+"/", "123:abc", "-100200")
+	if err := notifier.Notify(context.Background(), testRestock()); err != nil {
+		t.Fatal(err)
+	}
+
+	request := server.only(t)
+	if request.Path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %s, want /bot123:abc/sendMessage", request.Path)
+	}
+	var payload struct {
+		ChatID  string `json:"chat_id"`
+		Text    string `json:"text"`
+		Preview bool   `json:"disable_web_page_preview"`
+	}
+	if err := json.Unmarshal(request.Body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ChatID != "-100200" || !payload.Preview {
+		t.Errorf("payload = %+v", payload)
+	}
+	if !strings.HasPrefix(payload.Text, "Variant Restocked: Peak Tee\n") || !strings.Contains(payload.Text, "Stock: 4") {
+		t.Errorf("text = %q", payload.Text)
+	}
+}
+
+func TestTelegramNotifierRejected(t *testing.T) {
+	server := newRecorder(t, func(w http.ResponseWriter, _ int) {
+		w.Write([]byte(`{"ok":false,"description":"chat not found"}`))
+	})
+
+	err := NewTelegramNotifier(server.URL, "123:abc", "1").Notify(context.Background(), testCheckout())
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Fatalf("err = %v, want chat not found", err)
+	}
+}
+
+func TestWebhookNotifierPayload(t *testing.T) {
+	server := newRecorder(t, func(w http.ResponseWriter, _ int) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	notifier := NewWebhookNotifier(server.URL, map[string]string{"Authorization": "Bearer secret"})
+	if err := notifier.Notify(context.Background(), testRestock()); err != nil {
+		t.Fatal(err)
+	}
+
+	request := server.only(t)
+	if got := request.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := request.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(request.Body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"kind": "restock", "event": "Variant Restocked", "site": "peakkl", "product": "Peak Tee", "variant": "M", "price": 59.0}
+	for key, value := range want {
+		if payload[key] != value {
+			t.Errorf("%s = %v, want %v", key, payload[key], value)
+		}
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	server := newRecorder(t, func(w http.ResponseWriter, _ int) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	if err := NewWebhookNotifier(server.URL, nil).Notify(context.Background(), testCheckout()); err == nil {
+		t.Fatal("webhook returning 502 succeeded, want error")
+	}
+}
+
+func newTestDiscord(t *testing.T, server *recorder) (*DiscordNotifier, string) {
+	t.Helper()
+	deadLetters := filepath.Join(t.TempDir(), "undelivered.jsonl")
+	queue := NewDiscordQueue(server.Client(), func() string { return deadLetters })
+	return &DiscordNotifier{WebhookURL: server.URL, Queue: queue}, deadLetters
+}
+
+func decodeHook(t *testing.T, body []byte) Embed {
+	t.Helper()
+	var hook Hook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.Embeds) != 1 {
+		t.Fatalf("got %d embeds, want 1", len(hook.Embeds))
+	}
+	return hook.Embeds[0]
+}
+
+func fieldValue(embed Embed, name string) string {
+	for _, field := range embed.Fields {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+func TestDiscordNotifierPayloads(t *testing.T) {
+	failure := testCheckout()
+	failure.Kind = NotifyFailure
+	dryRun := testCheckout()
+	dryRun.DryRun = true
+
+	for _, tc := range []struct {
+		name   string
+		n      Notification
+		title  string
+		color  int
+		fields map[string]string
+	}{
+		{"checkout", testCheckout(), "Peak Tee", 0x00FF00, map[string]string{"Variant": "M", "Price": "59.00", "Task No": "3", "Country": "MY", "Checkout Link": "||https://peak.example/checkout/abc||"}},
+		{"failure", failure, "Checkout Failed!", 0xFF0000, map[string]string{"Product Name": "Peak Tee", "Checkout Link": ""}},
+		{"dry run", dryRun, "[DRY RUN] Peak Tee", 0xFFA500, map[string]string{"Checkout Link": "", "Dry Run": "Stopped before order placement, no order was created"}},
+		{"restock", testRestock(), "Variant Restocked: Peak Tee", 0x00FF00, map[string]string{"Site": "peakkl", "Variant": "M", "Stock": "0 -> 4"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newRecorder(t, func(w http.ResponseWriter, _ int) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+			discord, _ := newTestDiscord(t, server)
+
+			if err := discord.Notify(context.Background(), tc.n); err != nil {
+				t.Fatal(err)
+			}
+			if !discord.Queue.Flush(5 * time.Second) {
+				t.Fatal("queue did not drain")
+			}
+
+			embed := decodeHook(t, server.only(t).Body)
+			if embed.Title != tc.title || embed.Color != tc.color {
+				t.Errorf("title %q color %#x, want %q %#x", embed.Title, embed.Color, tc.title, tc.color)
+			}
+			for name, value := range tc.fields {
+				if got := fieldValue(embed, name); got != value {
+					t.Errorf("field %s = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildNotifiers(t *testing.T) {
+	entries, err := buildNotifiers(Config{
+		DiscordWebhook: "https://discord.example/hook",
+		Notifiers: []NotifierConfig{
+			{Type: "Slack", URL: "https://slack.example/hook", Events: []string{"Restock", "stock"}},
+			{Type: "telegram", Token: "t", ChatID: "c"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d notifiers, want 3", len(entries))
+	}
+
+	slack := entries[1]
+	if slack.name != "slack" || !slack.wants(NotifyRestock) || !slack.wants(NotifyStock) || slack.wants(NotifyCheckout) {
+		t.Errorf("slack entry = %+v", slack)
+	}
+	for _, kind := range []NotificationKind{NotifyCheckout, NotifyFailure, NotifyRestock, NotifyStock} {
+		if !entries[0].wants(kind) || !entries[2].wants(kind) {
+			t.Errorf("notifier without Events does not want %s", kind)
+		}
+	}
+}
+
+func TestBuildNotifiersErrors(t *testing.T) {
+	for _, nc := range []NotifierConfig{
+		{Type: "slack"},
+		{Type: "discord"},
+		{Type: "webhook"},
+		{Type: "telegram", Token: "t"},
+		{Type: "pager", URL: "https://example.com"},
+		{Type: "slack", URL: "https://slack.example/hook", Events: []string{"restocks"}},
+	} {
+		if _, err := buildNotifiers(Config{Notifiers: []NotifierConfig{nc}}); err == nil {
+			t.Errorf("buildNotifiers(%+v) succeeded, want error", nc)
+		}
+	}
+}
+
+func TestNotifyFiltersByEvent(t *testing.T) {
+	defer setNotifiers(nil)
+
+	checkouts := newRecorder(t, nil)
+	restocks := newRecorder(t, nil)
+	everything := newRecorder(t, func(w http.ResponseWriter, _ int) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	setNotifiers([]notifierEntry{
+		{name: "slack", notifier: NewSlackNotifier(checkouts.URL), events: map[NotificationKind]bool{NotifyCheckout: true, NotifyFailure: true}},
+		{name: "slack", notifier: NewSlackNotifier(restocks.URL), events: map[NotificationKind]bool{NotifyRestock: true}},
+		{name: "webhook", notifier: NewWebhookNotifier(everything.URL, nil)},
+	})
+
+	failure := testCheckout()
+	failure.Kind = NotifyFailure
+	failure.Error = "order rejected for buyer@example.com"
+	notify(testCheckout())
+	notify(failure)
+	notify(testRestock())
+	if !registry.NotifyQueue().Flush(5 * time.Second) {
+		t.Fatal("notifications not sent in time")
+	}
+
+	if got := len(checkouts.received()); got != 2 {
+		t.Errorf("checkout notifier got %d requests, want 2", got)
+	}
+	if got := len(restocks.received()); got != 1 {
+		t.Errorf("restock notifier got %d requests, want 1", got)
+	}
+	requests := everything.received()
+	if len(requests) != 3 {
+		t.Fatalf("unfiltered notifier got %d requests, want 3", len(requests))
+	}
+
+	var payload Notification
+	if err := json.Unmarshal(requests[1].Body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(payload.Error, "buyer@example.com") || !strings.Contains(payload.Error, "@example.com") {
+		t.Errorf("error %q was not redacted", payload.Error)
+	}
+}
+
+func TestNotifyDoesNotWaitForSlowNotifiers(t *testing.T) {
+	defer setNotifiers(nil)
+
+	release := make(chan struct{})
+	slow := newRecorder(t, func(w http.ResponseWriter, _ int) {
+		<-release
+	})
+	defer close(release)
+	setNotifiers([]notifierEntry{{name: "webhook", notifier: NewWebhookNotifier(slow.URL, nil)}})
+
+	started := time.Now()
+	notify(testCheckout())
+	if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+		t.Fatalf("notify took %v, want it to return without waiting for the webhook", elapsed)
+	}
+
+	started = time.Now()
+	if registry.NotifyQueue().Flush(100 * time.Millisecond) {
+		t.Fatal("flush reported success while the webhook is still hanging")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("flush took %v, want the hanging send canceled after the timeout", elapsed)
+	}
+}
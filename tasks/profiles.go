@@ -0,0 +1,349 @@
+package tasks
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Profile struct {
+	Name         string   `json:"name"`
+	Groups       []string `json:"groups,omitempty"`
+	FirstName    string   `json:"firstname"`
+	LastName     string   `json:"lastname"`
+	Email        string   `json:"email"`
+	Phone        string   `json:"phone"`
+	AddressLine1 string   `json:"address_line1"`
+	AddressLine2 string   `json:"address_line2"`
+	Zipcode      string   `json:"zipcode"`
+	City         string   `json:"city"`
+	State        string   `json:"state"`
+	Country      string   `json:"country,omitempty"`
+	CardNo       string   `json:"cardno,omitempty"`
+	ExpiryDate   string   `json:"expirydate,omitempty"`
+	CVV          string   `json:"cvv,omitempty"`
+}
+
+var profileColumns = []string{
+	"firstname", "lastname", "email", "phone",
+	"address_line1", "address_line2", "zipcode", "city", "state",
+	"cardno", "expirydate", "cvv",
+}
+
+var profileFileColumns = append(append([]string(nil), profileColumns...), "country")
+
+func (p Profile) values() map[string]string {
+	return map[string]string{
+		"firstname":     p.FirstName,
+		"lastname":      p.LastName,
+		"email":         p.Email,
+		"phone":         p.Phone,
+		"address_line1": p.AddressLine1,
+		"address_line2": p.AddressLine2,
+		"zipcode":       p.Zipcode,
+		"city":          p.City,
+		"state":         p.State,
+		"country":       p.Country,
+		"cardno":        p.CardNo,
+		"expirydate":    p.ExpiryDate,
+		"cvv":           p.CVV,
+	}
+}
+
+func (p *Profile) Set(column string, value string) {
+	switch column {
+	case "firstname":
+		p.FirstName = value
+	case "lastname":
+		p.LastName = value
+	case "email":
+		p.Email = value
+	case "phone":
+		p.Phone = value
+	case "address_line1":
+		p.AddressLine1 = value
+	case "address_line2":
+		p.AddressLine2 = value
+	case "zipcode":
+		p.Zipcode = value
+	case "city":
+		p.City = value
+	case "state":
+		p.State = value
+	case "country":
+		p.Country = value
+	case "cardno":
+		p.CardNo = value
+	case "expirydate":
+		p.ExpiryDate = value
+	case "cvv":
+		p.CVV = value
+	}
+}
+
+func (p Profile) secret() VaultSecret {
+	return VaultSecret{CardNo: p.CardNo, ExpiryDate: p.ExpiryDate, CVV: p.CVV}
+}
+
+func (p Profile) Get(column string) string {
+	return p.values()[column]
+}
+
+func (p Profile) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("profile name cannot be empty")
+	}
+	for _, column := range profileColumns {
+		if p.Get(column) == "" && !nullableColumns[column] {
+			return fmt.Errorf("profile %s: %s cannot be empty", p.Name, column)
+		}
+	}
+	if err := ValidateEmail(p.Email); err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	if err := ValidatePhone(p.Phone); err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	country, err := ParseCountry(p.Country)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	if err := ValidatePostcode(country, p.Zipcode); err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+type ProfileStore struct {
+	Profiles []Profile `json:"profiles"`
+}
+
+func (s *ProfileStore) Find(name string) *Profile {
+	for i := range s.Profiles {
+		if s.Profiles[i].Name == name {
+			return &s.Profiles[i]
+		}
+	}
+	return nil
+}
+
+func (s *ProfileStore) Group(name string) []Profile {
+	var members []Profile
+	for _, profile := range s.Profiles {
+		for _, group := range profile.Groups {
+			if group == name {
+				members = append(members, profile)
+				break
+			}
+		}
+	}
+	return members
+}
+
+func (s *ProfileStore) Put(profile Profile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	if len(s.Group(profile.Name)) > 0 {
+		return fmt.Errorf("profile name %q is already used by a profile group", profile.Name)
+	}
+	for _, group := range profile.Groups {
+		if existing := s.Find(group); existing != nil {
+			return fmt.Errorf("group name %q is already used by a profile", group)
+		}
+	}
+
+	if existing := s.Find(profile.Name); existing != nil {
+		*existing = profile
+		return nil
+	}
+	s.Profiles = append(s.Profiles, profile)
+	return nil
+}
+
+func (s *ProfileStore) Delete(name string) bool {
+	for i := range s.Profiles {
+		if s.Profiles[i].Name == name {
+			s.Profiles = append(s.Profiles[:i], s.Profiles[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ProfileStore) HasSecrets() bool {
+	for _, profile := range s.Profiles {
+		if !profile.secret().empty() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ProfileStore) Names() []string {
+	names := make([]string, len(s.Profiles))
+	for i, profile := range s.Profiles {
+		names[i] = profile.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ReadProfiles(path string) (*ProfileStore, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &ProfileStore{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s file: %w", path, err)
+	}
+	defer file.Close()
+
+	var store *ProfileStore
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		store, err = parseProfilesCSV(file)
+	} else {
+		store = &ProfileStore{}
+		err = json.NewDecoder(file).Decode(store)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, profile := range store.Profiles {
+		if seen[profile.Name] {
+			return nil, fmt.Errorf("error reading %s: duplicate profile %q", path, profile.Name)
+		}
+		seen[profile.Name] = true
+	}
+	for _, profile := range store.Profiles {
+		for _, group := range profile.Groups {
+			if seen[group] {
+				return nil, fmt.Errorf("error reading %s: group %q has the same name as a profile", path, group)
+			}
+		}
+	}
+
+	return store, nil
+}
+
+func parseProfilesCSV(r io.Reader) (*ProfileStore, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	headers, err := reader.Read()
+	if err == io.EOF {
+		return &ProfileStore{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+
+	columnIndex := make(map[string]int)
+	for i, header := range headers {
+		columnIndex[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	if _, ok := columnIndex["name"]; !ok {
+		return nil, errors.New("name column missing from header")
+	}
+
+	store := &ProfileStore{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		get := func(column string) string {
+			if i, ok := columnIndex[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		profile := Profile{Name: get("name")}
+		for _, column := range profileFileColumns {
+			profile.Set(column, get(column))
+		}
+		if groups := get("groups"); groups != "" {
+			profile.Groups = splitGroups(groups)
+		}
+		store.Profiles = append(store.Profiles, profile)
+	}
+	return store, nil
+}
+
+func splitGroups(s string) []string {
+	var groups []string
+	for _, group := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == ',' }) {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+func WriteProfiles(path string, store *ProfileStore) error {
+	for _, profile := range store.Profiles {
+		if !profile.secret().empty() {
+			return fmt.Errorf("profile %s has card details, move them into the vault before saving %s", profile.Name, path)
+		}
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", path, err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		cw := csv.NewWriter(file)
+		cw.Write(append([]string{"name", "groups"}, profileFileColumns...))
+		for _, profile := range store.Profiles {
+			record := []string{profile.Name, strings.Join(profile.Groups, "|")}
+			for _, column := range profileFileColumns {
+				record = append(record, profile.Get(column))
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		err = cw.Error()
+	} else {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "    ")
+		err = encoder.Encode(store)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func LoadProfiles(path string) error {
+	store, err := ReadProfiles(path)
+	if err != nil {
+		return err
+	}
+
+	registry.SetProfiles(store)
+	return nil
+}
+
+func expandProfile(name string) ([]Profile, bool) {
+	return registry.ExpandProfile(name)
+}
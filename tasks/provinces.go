@@ -2,8 +2,13 @@ package tasks
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 type Province struct {
@@ -17,33 +22,219 @@ type ProvinceResponse struct {
 	Provinces []Province `json:"provinces"`
 }
 
-var provinces []Province
+const defaultCountry = "MY"
 
-func LoadProvinces(link string) error {
-	resp, err := http.Get(link)
+type provinceCacheEntry struct {
+	FetchedAt time.Time  `json:"fetched_at"`
+	Provinces []Province `json:"provinces"`
+}
+
+var provinceAliases = map[string]string{
+	"kl":           "kuala lumpur",
+	"n9":           "negeri sembilan",
+	"ns":           "negeri sembilan",
+	"n sembilan":   "negeri sembilan",
+	"pulau pinang": "penang",
+	"p pinang":     "penang",
+	"malacca":      "melaka",
+	"tganu":        "terengganu",
+	"trengganu":    "terengganu",
+}
+
+var provincePrefixes = []string{"wilayah persekutuan ", "federal territory of ", "federal territory ", "wp ", "negeri "}
+
+func provinceCacheKey(site string, country string) string {
+	return site + "/" + strings.ToUpper(country)
+}
+
+func readProvinceCache(site string, country string) (provinceCacheEntry, bool) {
+	registry.provinceCacheMu.Lock()
+	defer registry.provinceCacheMu.Unlock()
+
+	entries, err := loadProvinceCache(GetProvinceCacheFile())
 	if err != nil {
-		return fmt.Errorf("error making request to %s: %w", link, err)
+		Logger().Warn("Ignoring province cache", "file", GetProvinceCacheFile(), "err", err)
+		return provinceCacheEntry{}, false
+	}
+	entry, ok := entries[provinceCacheKey(site, country)]
+	return entry, ok
+}
+
+func writeProvinceCache(site string, country string, provinces []Province) error {
+	registry.provinceCacheMu.Lock()
+	defer registry.provinceCacheMu.Unlock()
+
+	path := GetProvinceCacheFile()
+	entries, err := loadProvinceCache(path)
+	if err != nil {
+		entries = make(map[string]provinceCacheEntry)
+	}
+	entries[provinceCacheKey(site, country)] = provinceCacheEntry{FetchedAt: time.Now(), Provinces: provinces}
+
+	bytes, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", path, err)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("error creating %s: %w", dir, err)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadProvinceCache(path string) (map[string]provinceCacheEntry, error) {
+	entries := make(map[string]provinceCacheEntry)
+	bytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s file: %w", path, err)
+	}
+	if err := json.Unmarshal(bytes, &entries); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+func LoadProvinces(site string, country string) error {
+	cached, hasCache := readProvinceCache(site, country)
+	if hasCache && time.Since(cached.FetchedAt) < GetProvinceCacheTTL() {
+		registry.SetProvinces(site, country, cached.Provinces)
+		return nil
+	}
+
+	provinces, err := fetchProvinces(site, country)
+	if err != nil {
+		if !hasCache {
+			return err
+		}
+		Logger().Warn("Using cached provinces, the store did not respond", "site", site, "country", country, "cached_at", cached.FetchedAt.Format(time.DateTime), "err", err)
+		registry.SetProvinces(site, country, cached.Provinces)
+		return nil
+	}
+
+	registry.SetProvinces(site, country, provinces)
+	if err := writeProvinceCache(site, country, provinces); err != nil {
+		Logger().Warn("Failed to cache provinces", "site", site, "country", country, "err", err)
+	}
+	return nil
+}
+
+func fetchProvinces(site string, country string) ([]Province, error) {
+	link, err := GetSiteLink(site)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/sf/countries/%s/provinces", link, country)
+
+	client := &http.Client{Timeout: GetRequestTimeout()}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to %s: %w", url, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
 	}
 
 	var provinceResponse ProvinceResponse
 	if err := json.NewDecoder(resp.Body).Decode(&provinceResponse); err != nil {
-		return fmt.Errorf("error decoding response: %w", err)
+		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
+	return provinceResponse.Provinces, nil
+}
 
-	provinces = provinceResponse.Provinces
-	return nil
+func GetProvinceCode(site string, country string, provinceName string) (string, error) {
+	province, err := registry.Province(site, country, provinceName)
+	if err != nil {
+		return "", err
+	}
+	return province.Code, nil
+}
+
+func normalizeProvince(name string) string {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer(".", "", ",", " ", "-", " ", "'", "", "(", " ", ")", " ").Replace(name)
+	name = strings.Join(strings.Fields(name), " ")
+	for _, prefix := range provincePrefixes {
+		if trimmed := strings.TrimPrefix(name, prefix); trimmed != name && trimmed != "" {
+			return trimmed
+		}
+	}
+	return name
 }
 
-func GetProvinceCode(provinceName string) (string, error) {
+func matchProvince(provinces []Province, input string) (Province, error) {
 	for _, province := range provinces {
-		if province.Name == provinceName {
-			return province.Code, nil
+		if strings.EqualFold(province.Name, input) || strings.EqualFold(province.Code, strings.TrimSpace(input)) {
+			return province, nil
+		}
+	}
+
+	wanted := normalizeProvince(input)
+	if alias, ok := provinceAliases[wanted]; ok {
+		wanted = normalizeProvince(alias)
+	}
+	names := make([]string, len(provinces))
+	for i, province := range provinces {
+		names[i] = normalizeProvince(province.Name)
+		if names[i] == wanted {
+			return province, nil
+		}
+	}
+
+	var prefixed []Province
+	for i, name := range names {
+		if len(wanted) >= 3 && (strings.HasPrefix(name, wanted) || strings.HasPrefix(strings.ToLower(provinces[i].Name), wanted)) {
+			prefixed = append(prefixed, provinces[i])
+		}
+	}
+	if len(prefixed) == 1 {
+		return prefixed[0], nil
+	}
+
+	best, bestDistance, tied := -1, 0, false
+	for i, name := range names {
+		distance := editDistance(wanted, name)
+		switch {
+		case best < 0 || distance < bestDistance:
+			best, bestDistance, tied = i, distance, false
+		case distance == bestDistance:
+			tied = true
+		}
+	}
+	if best >= 0 && !tied && bestDistance <= len(names[best])/4 && bestDistance <= 2 {
+		return provinces[best], nil
+	}
+	if best >= 0 && bestDistance <= len(wanted)/2 {
+		return Province{}, fmt.Errorf("province not found: %s, did you mean %q?", input, provinces[best].Name)
+	}
+	return Province{}, fmt.Errorf("province not found: %s", input)
+}
+
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
 		}
+		prev, curr = curr, prev
 	}
-	return "", fmt.Errorf("province not found: %s", provinceName)
+	return prev[len(b)]
 }
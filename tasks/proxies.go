@@ -1,10 +1,250 @@
 package tasks
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 )
 
-func TestProxies() {
-	fmt.Println("Testing proxies...")
-	// Implement proxy testing logic here
+const DefaultProxyGroup = "default"
+
+type Proxy struct {
+	Group    string
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+func (p Proxy) URL() *url.URL {
+	u := &url.URL{Scheme: "http", Host: net.JoinHostPort(p.Host, p.Port)}
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	return u
+}
+
+func (p Proxy) String() string {
+	return net.JoinHostPort(p.Host, p.Port)
+}
+
+func LoadProxies(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		setProxies(map[string][]Proxy{})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening %s file: %w", path, err)
+	}
+	defer file.Close()
+
+	groups, err := ParseProxies(file)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	setProxies(groups)
+	return nil
+}
+
+func ParseProxies(r io.Reader) (map[string][]Proxy, error) {
+	groups := make(map[string][]Proxy)
+	group := DefaultProxyGroup
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			group = strings.TrimSpace(text[1 : len(text)-1])
+			if group == "" {
+				return nil, fmt.Errorf("line %d: empty group name", line)
+			}
+			continue
+		}
+
+		proxy, err := parseProxy(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		proxy.Group = group
+		groups[group] = append(groups[group], proxy)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func parseProxy(text string) (Proxy, error) {
+	parts := strings.Split(text, ":")
+	switch len(parts) {
+	case 2:
+		return Proxy{Host: parts[0], Port: parts[1]}, validateProxy(text, parts)
+	case 4:
+		return Proxy{Host: parts[0], Port: parts[1], Username: parts[2], Password: parts[3]}, validateProxy(text, parts)
+	default:
+		return Proxy{}, fmt.Errorf("invalid proxy %q, expected host:port or host:port:user:pass", text)
+	}
+}
+
+func validateProxy(text string, parts []string) error {
+	if parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid proxy %q, expected host:port or host:port:user:pass", text)
+	}
+	return nil
+}
+
+func setProxies(groups map[string][]Proxy) {
+	registry.SetProxies(groups)
+}
+
+func HasProxyGroup(group string) bool {
+	return registry.HasProxyGroup(group)
+}
+
+func ListProxies() []Proxy {
+	return registry.Proxies()
+}
+
+func assignProxy(group string) *Proxy {
+	if group == "" {
+		return nil
+	}
+
+	proxy, ok := registry.NextProxy(group)
+	if !ok {
+		return nil
+	}
+	return &proxy
+}
+
+func newHTTPClient(proxy *Proxy) *http.Client {
+	jar, _ := cookiejar.New(nil)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy.URL())
+	}
+	return &http.Client{Jar: jar, Transport: transport, Timeout: GetRequestTimeout()}
+}
+
+func newRotatingHTTPClient(group string) *http.Client {
+	client := newHTTPClient(nil)
+	client.Transport.(*http.Transport).Proxy = func(*http.Request) (*url.URL, error) {
+		if proxy := assignProxy(group); proxy != nil {
+			return proxy.URL(), nil
+		}
+		return nil, nil
+	}
+	return client
+}
+
+type ProxyResult struct {
+	Proxy   Proxy
+	Status  int
+	Latency time.Duration
+	Err     error
+}
+
+func CheckProxies(proxies []Proxy, target string, timeout time.Duration) []ProxyResult {
+	results := make([]ProxyResult, len(proxies))
+	var wg sync.WaitGroup
+
+	for i, proxy := range proxies {
+		wg.Add(1)
+		go func(i int, proxy Proxy) {
+			defer wg.Done()
+			results[i] = checkProxy(proxy, target, timeout)
+		}(i, proxy)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func checkProxy(proxy Proxy, target string, timeout time.Duration) ProxyResult {
+	client := newHTTPClient(&proxy)
+	client.Timeout = timeout
+
+	start := time.Now()
+	resp, err := client.Get(target)
+	if err != nil {
+		return ProxyResult{Proxy: proxy, Latency: time.Since(start), Err: err}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	result := ProxyResult{Proxy: proxy, Status: resp.StatusCode, Latency: time.Since(start)}
+	if resp.StatusCode >= 400 {
+		result.Err = fmt.Errorf("received status %d", resp.StatusCode)
+	}
+	return result
+}
+
+func PrintProxyResults(w io.Writer, results []ProxyResult) int {
+	failures := 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROXY\tGROUP\tSTATUS\tLATENCY\tERROR")
+	for _, result := range results {
+		status := "-"
+		if result.Status != 0 {
+			status = fmt.Sprintf("%d", result.Status)
+		}
+		errText := ""
+		if result.Err != nil {
+			failures++
+			errText = result.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", result.Proxy, result.Proxy.Group, status, result.Latency.Round(time.Millisecond), errText)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%d/%d proxies working\n", len(results)-failures, len(results))
+	return failures
+}
+
+func TestProxies(files Files, group string, target string) (int, error) {
+	if err := LoadConfig(files.Config); err != nil {
+		return 0, fmt.Errorf("error loading configuration: %w", err)
+	}
+
+	if err := LoadProxies(files.Proxies); err != nil {
+		return 0, err
+	}
+
+	proxies := ListProxies()
+	if group != "" {
+		var filtered []Proxy
+		for _, proxy := range proxies {
+			if proxy.Group == group {
+				filtered = append(filtered, proxy)
+			}
+		}
+		proxies = filtered
+	}
+	if len(proxies) == 0 {
+		return 0, fmt.Errorf("no proxies found in %s", files.Proxies)
+	}
+
+	if target == "" {
+		target = GetProxyTestURL()
+	}
+	Logger().Info("Testing proxies", "proxies", len(proxies), "target", target)
+	results := CheckProxies(proxies, target, GetProxyTestTimeout())
+	return PrintProxyResults(os.Stdout, results), nil
 }
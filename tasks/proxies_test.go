@@ -0,0 +1,194 @@
+package tasks
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testProxy struct {
+	*httptest.Server
+	hits int32
+}
+
+func newTestProxy(t *testing.T, auth string) *testProxy {
+	t.Helper()
+	p := &testProxy{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&p.hits, 1)
+		if auth != "" && r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		if !r.URL.IsAbs() {
+			http.Error(w, "not a proxy request", http.StatusBadRequest)
+			return
+		}
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *testProxy) proxy(t *testing.T, group string, credentials ...string) Proxy {
+	t.Helper()
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(u.Host)
+	proxy := Proxy{Group: group, Host: host, Port: port}
+	if len(credentials) == 2 {
+		proxy.Username, proxy.Password = credentials[0], credentials[1]
+	}
+	return proxy
+}
+
+func TestParseProxies(t *testing.T) {
+	input := `# comment
+1.2.3.4:8080
+[residential]
+5.6.7.8:9000:user:pass
+
+[datacenter]
+9.9.9.9:3128
+`
+	groups, err := ParseProxies(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]Proxy{
+		DefaultProxyGroup: {{Group: DefaultProxyGroup, Host: "1.2.3.4", Port: "8080"}},
+		"residential":     {{Group: "residential", Host: "5.6.7.8", Port: "9000", Username: "user", Password: "pass"}},
+		"datacenter":      {{Group: "datacenter", Host: "9.9.9.9", Port: "3128"}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(want))
+	}
+	for name, proxies := range want {
+		if len(groups[name]) != len(proxies) || groups[name][0] != proxies[0] {
+			t.Errorf("group %s = %+v, want %+v", name, groups[name], proxies)
+		}
+	}
+}
+
+func TestParseProxiesErrors(t *testing.T) {
+	for _, input := range []string{"1.2.3.4", "1.2.3.4:8080:user", ":8080", "[]\n1.2.3.4:8080"} {
+		if _, err := ParseProxies(strings.NewReader(input)); err == nil {
+			t.Errorf("ParseProxies(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestCheckProxies(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	working := newTestProxy(t, "")
+	authenticated := newTestProxy(t, "user:secret")
+	dead := newTestProxy(t, "")
+	deadProxy := dead.proxy(t, "dead")
+	dead.Close()
+
+	proxies := []Proxy{
+		working.proxy(t, "open"),
+		authenticated.proxy(t, "auth", "user", "secret"),
+		authenticated.proxy(t, "auth", "user", "wrong"),
+		deadProxy,
+	}
+	results := CheckProxies(proxies, target.URL, 2*time.Second)
+	if len(results) != len(proxies) {
+		t.Fatalf("got %d results, want %d", len(results), len(proxies))
+	}
+
+	for i, want := range []struct {
+		status int
+		ok     bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusOK, true},
+		{http.StatusProxyAuthRequired, false},
+		{0, false},
+	} {
+		result := results[i]
+		if result.Proxy != proxies[i] {
+			t.Errorf("result %d is for %v, want %v", i, result.Proxy, proxies[i])
+		}
+		if result.Status != want.status || (result.Err == nil) != want.ok {
+			t.Errorf("result %d: status %d err %v, want status %d ok %v", i, result.Status, result.Err, want.status, want.ok)
+		}
+	}
+	if hits, authHits := atomic.LoadInt32(&working.hits), atomic.LoadInt32(&authenticated.hits); hits != 1 || authHits != 2 {
+		t.Errorf("proxy hits = %d and %d, want 1 and 2", hits, authHits)
+	}
+}
+
+func TestCheckProxiesTimeout(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer target.Close()
+
+	proxy := newTestProxy(t, "")
+	results := CheckProxies([]Proxy{proxy.proxy(t, "slow")}, target.URL, 100*time.Millisecond)
+	if results[0].Err == nil {
+		t.Fatal("slow proxy succeeded, want timeout")
+	}
+}
+
+func TestAssignProxyRoundRobin(t *testing.T) {
+	defer setProxies(map[string][]Proxy{})
+
+	a, b := Proxy{Group: "g", Host: "a", Port: "1"}, Proxy{Group: "g", Host: "b", Port: "1"}
+	setProxies(map[string][]Proxy{"g": {a, b}})
+
+	for i, want := range []Proxy{a, b, a} {
+		if got := assignProxy("g"); got == nil || *got != want {
+			t.Errorf("assignment %d = %v, want %v", i, got, want)
+		}
+	}
+	if got := assignProxy(""); got != nil {
+		t.Errorf("assignProxy(\"\") = %v, want nil", got)
+	}
+	if got := assignProxy("missing"); got != nil {
+		t.Errorf("assignProxy(\"missing\") = %v, want nil", got)
+	}
+}
+
+func TestRotatingClientSpreadsRequests(t *testing.T) {
+	defer setProxies(map[string][]Proxy{})
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	first, second := newTestProxy(t, ""), newTestProxy(t, "")
+	setProxies(map[string][]Proxy{"monitor": {first.proxy(t, "monitor"), second.proxy(t, "monitor")}})
+
+	client := newRotatingHTTPClient("monitor")
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(target.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if firstHits, secondHits := atomic.LoadInt32(&first.hits), atomic.LoadInt32(&second.hits); firstHits != 2 || secondHits != 2 {
+		t.Fatalf("proxy hits = %d and %d, want 2 and 2", firstHits, secondHits)
+	}
+}
@@ -0,0 +1,336 @@
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type Query struct {
+	raw         string
+	root        queryNode
+	implicitAnd bool
+}
+
+type QueryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid keyword query at position %d: %s", e.Pos+1, e.Msg)
+}
+
+type queryNode interface {
+	match(name string, folded string) bool
+}
+
+type termNode struct {
+	text string
+}
+
+func (n termNode) match(name string, folded string) bool {
+	return strings.Contains(folded, n.text)
+}
+
+type regexNode struct {
+	re *regexp.Regexp
+}
+
+func (n regexNode) match(name string, folded string) bool {
+	return n.re.MatchString(name) || n.re.MatchString(folded)
+}
+
+type notNode struct {
+	node queryNode
+}
+
+func (n notNode) match(name string, folded string) bool {
+	return !n.node.match(name, folded)
+}
+
+type andNode []queryNode
+
+func (n andNode) match(name string, folded string) bool {
+	for _, node := range n {
+		if !node.match(name, folded) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode []queryNode
+
+func (n orNode) match(name string, folded string) bool {
+	for _, node := range n {
+		if node.match(name, folded) {
+			return true
+		}
+	}
+	return false
+}
+
+func ParseQuery(raw string) (*Query, error) {
+	tokens, err := tokenizeQuery(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens, end: len(raw)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != nil {
+		return nil, &QueryError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+
+	return &Query{raw: raw, root: root, implicitAnd: p.implicitAnd}, nil
+}
+
+func (q *Query) Match(name string) bool {
+	return q.root.match(name, foldText(name))
+}
+
+func (q *Query) String() string {
+	return q.raw
+}
+
+func (q *Query) ImplicitAnd() bool {
+	return q.implicitAnd
+}
+
+type queryTokenKind int
+
+const (
+	tokenTerm queryTokenKind = iota
+	tokenPhrase
+	tokenRegex
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+}
+
+func tokenizeQuery(raw string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(raw)
+	offsets := make([]int, len(runes)+1)
+	offset := 0
+	for i, r := range runes {
+		offsets[i] = offset
+		offset += len(string(r))
+	}
+	offsets[len(runes)] = offset
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := offsets[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen, text: "(", pos: start})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenClose, text: ")", pos: start})
+			i++
+		case r == '&':
+			tokens = append(tokens, queryToken{kind: tokenAnd, text: "&", pos: start})
+			i++
+		case r == ',' || r == '|':
+			tokens = append(tokens, queryToken{kind: tokenOr, text: string(r), pos: start})
+			i++
+		case r == '-':
+			tokens = append(tokens, queryToken{kind: tokenNot, text: "-", pos: start})
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				j++
+			}
+			if j == len(runes) {
+				return nil, &QueryError{Pos: start, Msg: "unterminated quoted phrase"}
+			}
+			tokens = append(tokens, queryToken{kind: tokenPhrase, text: string(runes[i+1 : j]), pos: start})
+			i = j + 1
+		case r == '/':
+			var pattern strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '/'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) && runes[j+1] == '/' {
+					j++
+				}
+				pattern.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, &QueryError{Pos: start, Msg: "unterminated regular expression"}
+			}
+			tokens = append(tokens, queryToken{kind: tokenRegex, text: pattern.String(), pos: start})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && isTermRune(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, queryToken{kind: tokenTerm, text: string(runes[i:j]), pos: start})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+func isTermRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`()&,|"`, r)
+}
+
+type queryParser struct {
+	tokens      []queryToken
+	next        int
+	end         int
+	implicitAnd bool
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.next >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.next]
+}
+
+func (p *queryParser) pos() int {
+	if tok := p.peek(); tok != nil {
+		return tok.pos
+	}
+	return p.end
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	var nodes orNode
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		tok := p.peek()
+		if tok == nil || tok.kind != tokenOr {
+			break
+		}
+		p.next++
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var nodes andNode
+	for {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		tok := p.peek()
+		if tok == nil || tok.kind == tokenOr || tok.kind == tokenClose {
+			break
+		}
+		if tok.kind == tokenAnd {
+			p.next++
+		} else {
+			p.implicitAnd = true
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, &QueryError{Pos: p.end, Msg: "expected keyword"}
+	}
+
+	switch tok.kind {
+	case tokenNot:
+		p.next++
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: node}, nil
+	case tokenOpen:
+		p.next++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing == nil || closing.kind != tokenClose {
+			return nil, &QueryError{Pos: p.pos(), Msg: "missing closing parenthesis"}
+		}
+		p.next++
+		return node, nil
+	case tokenTerm, tokenPhrase:
+		p.next++
+		text := foldText(strings.TrimSpace(tok.text))
+		if text == "" {
+			return nil, &QueryError{Pos: tok.pos, Msg: "empty phrase"}
+		}
+		return termNode{text: text}, nil
+	case tokenRegex:
+		p.next++
+		re, err := regexp.Compile("(?i)" + tok.text)
+		if err != nil {
+			return nil, &QueryError{Pos: tok.pos, Msg: err.Error()}
+		}
+		return regexNode{re: re}, nil
+	default:
+		return nil, &QueryError{Pos: tok.pos, Msg: fmt.Sprintf("expected keyword, got %q", tok.text)}
+	}
+}
+
+var diacritics = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a', 'ă': 'a', 'ą': 'a',
+	'ç': 'c', 'ć': 'c', 'ĉ': 'c', 'č': 'c',
+	'ď': 'd', 'đ': 'd',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e', 'ė': 'e', 'ę': 'e', 'ě': 'e',
+	'ğ': 'g', 'ĝ': 'g',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ī': 'i', 'į': 'i', 'ı': 'i',
+	'ł': 'l', 'ľ': 'l',
+	'ñ': 'n', 'ń': 'n', 'ň': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ō': 'o', 'ő': 'o',
+	'ŕ': 'r', 'ř': 'r',
+	'ś': 's', 'ş': 's', 'š': 's', 'ß': 's',
+	'ţ': 't', 'ť': 't',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u', 'ů': 'u', 'ű': 'u', 'ų': 'u',
+	'ý': 'y', 'ÿ': 'y',
+	'ź': 'z', 'ż': 'z', 'ž': 'z',
+}
+
+func foldText(s string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if folded, ok := diacritics[r]; ok {
+			return folded
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		name  string
+		want  bool
+	}{
+		{"dunk", "Nike Dunk Low Panda", true},
+		{"dunk low", "Nike Dunk Low Panda", true},
+		{"dunk high", "Nike Dunk Low Panda", false},
+		{"dunk -kids", "Nike Dunk Low Panda", true},
+		{"dunk -kids", "Nike Dunk Low Panda (Kids)", false},
+		{"-(kids | gs) dunk", "Nike Dunk Low GS", false},
+		{"t-shirt", "Peak Logo T-Shirt", true},
+		{`"low panda"`, "Nike Dunk Low Panda", true},
+		{`"panda low"`, "Nike Dunk Low Panda", false},
+		{`"dunk low" -"dunk low pro"`, "Nike SB Dunk Low Pro", false},
+		{"(dunk | jordan) & low", "Air Jordan 1 Low", true},
+		{"(dunk | jordan) & low", "Air Jordan 1 High", false},
+		{"(dunk | jordan) low", "Nike Dunk Low", true},
+		{"dunk, jordan", "Air Jordan 4", true},
+		{"dunk | jordan", "Yeezy Slide", false},
+		{"dunk & panda", "Nike Dunk Low Panda", true},
+		{"dunk & panda", "Nike Dunk Low Grey", false},
+		{"dunk low, jordan high", "Air Jordan 1 High", true},
+		{"dunk low, jordan high", "Air Jordan 1 Low", false},
+		{"/dunk (low|high)/", "Nike DUNK High", true},
+		{"/dunk (low|high)/", "Nike Dunk Mid", false},
+		{`/1\/2 zip/`, "Peak 1/2 Zip Fleece", true},
+		{`/1\/2 zip/`, "Peak 1 2 Zip Fleece", false},
+		{"creme brulee", "Crème Brûlée Tee", true},
+		{"crème", "Creme Tee", true},
+		{"/creme/", "Crème Tee", true},
+		{"SÃO PAULO", "sao paulo jersey", true},
+	} {
+		q, err := ParseQuery(tc.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error: %v", tc.query, err)
+			continue
+		}
+		if got := q.Match(tc.name); got != tc.want {
+			t.Errorf("ParseQuery(%q).Match(%q) = %v, want %v", tc.query, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestQueryImplicitAnd(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  bool
+	}{
+		{"dunk low", true},
+		{"dunk & low", false},
+		{"dunk, low", false},
+		{`"dunk low"`, false},
+	} {
+		q, err := ParseQuery(tc.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error: %v", tc.query, err)
+		}
+		if got := q.ImplicitAnd(); got != tc.want {
+			t.Errorf("ParseQuery(%q).ImplicitAnd() = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestQueryErrorPos(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		pos   int
+	}{
+		{`dunk "low`, 5},
+		{`"`, 0},
+		{`é "low`, 3},
+		{"dunk /low", 5},
+		{`/1\/2`, 0},
+		{"dunk /[/", 5},
+		{`dunk ""`, 5},
+		{"(dunk | jordan", 14},
+		{"dunk &", 6},
+		{"dunk )", 5},
+		{"| dunk", 0},
+	} {
+		_, err := ParseQuery(tc.query)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("ParseQuery(%q) error = %v, want a QueryError", tc.query, err)
+			continue
+		}
+		if queryErr.Pos != tc.pos {
+			t.Errorf("ParseQuery(%q) error at %d (%s), want %d", tc.query, queryErr.Pos, queryErr.Msg, tc.pos)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package tasks
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	cardRegex      = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	emailTextRegex = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phoneTextRegex = regexp.MustCompile(`(?:\+?6)?01\d[ -]?\d{3,4}[ -]?\d{4}\b`)
+)
+
+var (
+	secretMu     sync.RWMutex
+	knownSecrets = map[string]string{}
+	secretsCache *strings.Replacer
+	cvvCache     *regexp.Regexp
+)
+
+var secretKeys = map[string]string{
+	"cardno":      "cardno",
+	"card_number": "cardno",
+	"cvv":         "cvv",
+	"cvc":         "cvv",
+	"csc":         "cvv",
+	"expirydate":  "expirydate",
+	"expiry":      "expirydate",
+	"exp":         "expirydate",
+	"email":       "email",
+	"phone":       "phone",
+	"_token":      "token",
+	"xsrf_token":  "token",
+	"first_name":  "firstname",
+	"last_name":   "lastname",
+	"firstname":   "firstname",
+	"lastname":    "lastname",
+	"address1":    "address_line1",
+	"address2":    "address_line2",
+	"zip":         "zipcode",
+}
+
+var keyedSecretRegex = regexp.MustCompile(`(?i)\b(cvv|cvc|csc|expiry(?:date)?)(["']?\s*[:=]\s*["']?)([0-9/]{3,7})`)
+
+func registerSecret(column string, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" || (column != "cvv" && len(value) < 4) {
+		return
+	}
+
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	if knownSecrets[value] != column {
+		knownSecrets[value] = column
+		secretsCache = nil
+		cvvCache = nil
+	}
+}
+
+func registerTaskSecrets(task Task) {
+	registerSecret("email", task.Email)
+	registerSecret("phone", task.Phone)
+	registerSecret("cardno", task.CardNo)
+	registerSecret("expirydate", task.ExpiryDate)
+	registerSecret("cvv", task.CVV)
+	registerSecret("email", task.Receiver.Email)
+	registerSecret("phone", task.Receiver.Phone)
+}
+
+func registerVaultSecret(secret VaultSecret) {
+	registerSecret("cardno", secret.CardNo)
+	registerSecret("expirydate", secret.ExpiryDate)
+	registerSecret("cvv", secret.CVV)
+}
+
+func secretReplacers() (*strings.Replacer, *regexp.Regexp) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	if secretsCache == nil {
+		var pairs []string
+		var cvvs []string
+		for value, column := range knownSecrets {
+			if column == "cvv" {
+				cvvs = append(cvvs, regexp.QuoteMeta(value))
+				continue
+			}
+			pairs = append(pairs, value, redactValue(column, value))
+		}
+		secretsCache = strings.NewReplacer(pairs...)
+		if len(cvvs) > 0 {
+			cvvCache = regexp.MustCompile(`(?i)(\b(?:cvv|cvc|csc|security code)\D{0,20}?)\b(` + strings.Join(cvvs, "|") + `)\b`)
+		}
+	}
+	return secretsCache, cvvCache
+}
+
+func secretKey(key string) (string, bool) {
+	key = strings.ToLower(key)
+	if i := strings.LastIndex(key, "["); i >= 0 {
+		key = strings.TrimSuffix(key[i+1:], "]")
+	}
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	column, ok := secretKeys[key]
+	return column, ok
+}
+
+func RedactCard(card string) string {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(card)
+	if len(digits) < 4 {
+		return strings.Repeat("*", len(digits))
+	}
+	return "**** **** **** " + digits[len(digits)-4:]
+}
+
+func RedactEmail(email string) string {
+	user, domain, ok := strings.Cut(email, "@")
+	if !ok || user == "" {
+		return RedactPhone(email)
+	}
+	return user[:1] + strings.Repeat("*", len(user)-1) + "@" + domain
+}
+
+func RedactPhone(phone string) string {
+	if len(phone) <= 3 {
+		return strings.Repeat("*", len(phone))
+	}
+	return strings.Repeat("*", len(phone)-3) + phone[len(phone)-3:]
+}
+
+func RedactCVV(cvv string) string {
+	return strings.Repeat("*", len(cvv))
+}
+
+func RedactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
+
+func RedactName(name string) string {
+	runes := []rune(name)
+	if len(runes) <= 1 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[0]) + strings.Repeat("*", len(runes)-1)
+}
+
+func RedactAddress(address string) string {
+	if address == "" {
+		return ""
+	}
+	return "****"
+}
+
+func RedactPostcode(postcode string) string {
+	if len(postcode) <= 2 {
+		return strings.Repeat("*", len(postcode))
+	}
+	return postcode[:2] + strings.Repeat("*", len(postcode)-2)
+}
+
+func RedactExpiry(expiry string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return '*'
+		}
+		return r
+	}, expiry)
+}
+
+func Redact(text string) string {
+	if !redactionEnabled() {
+		return text
+	}
+	replacer, cvvs := secretReplacers()
+	text = replacer.Replace(text)
+	text = keyedSecretRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := keyedSecretRegex.FindStringSubmatch(match)
+		return parts[1] + parts[2] + redactValue(secretKeys[strings.ToLower(parts[1])], parts[3])
+	})
+	if cvvs != nil {
+		text = cvvs.ReplaceAllStringFunc(text, func(match string) string {
+			parts := cvvs.FindStringSubmatch(match)
+			return parts[1] + RedactCVV(parts[2])
+		})
+	}
+	text = cardRegex.ReplaceAllStringFunc(text, func(match string) string {
+		if !luhnValid(match) {
+			return match
+		}
+		return RedactCard(match)
+	})
+	text = emailTextRegex.ReplaceAllStringFunc(text, RedactEmail)
+	return phoneTextRegex.ReplaceAllStringFunc(text, RedactPhone)
+}
+
+func redactValue(column string, value string) string {
+	if !redactionEnabled() {
+		return value
+	}
+	switch column {
+	case "cardno":
+		return RedactCard(value)
+	case "cvv":
+		return RedactCVV(value)
+	case "expirydate":
+		return RedactExpiry(value)
+	case "email":
+		return RedactEmail(value)
+	case "phone":
+		return RedactPhone(value)
+	case "token":
+		return RedactSecret(value)
+	case "firstname", "lastname":
+		return RedactName(value)
+	case "address_line1", "address_line2":
+		return RedactAddress(value)
+	case "zipcode":
+		return RedactPostcode(value)
+	default:
+		return value
+	}
+}
+
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	digits := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
@@ -0,0 +1,303 @@
+package tasks
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type provinceKey struct {
+	site    string
+	country string
+}
+
+type Registry struct {
+	mu        sync.RWMutex
+	sites     []Site
+	config    Config
+	notifiers []notifierEntry
+	dryRun    bool
+	provinces map[provinceKey][]Province
+	profiles  *ProfileStore
+	vault     *Vault
+	proxies   map[string][]Proxy
+	proxyNext map[string]int
+	shipping  map[shippingKey]shippingCacheEntry
+	scrapes   map[string]time.Duration
+	history   *History
+	board     *runBoard
+	discord   *DiscordQueue
+	notify    *NotifyQueue
+
+	provinceCacheMu sync.Mutex
+}
+
+var registry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		provinces: make(map[provinceKey][]Province),
+		profiles:  &ProfileStore{},
+		proxies:   make(map[string][]Proxy),
+		proxyNext: make(map[string]int),
+		shipping:  make(map[shippingKey]shippingCacheEntry),
+		scrapes:   make(map[string]time.Duration),
+	}
+}
+
+func (r *Registry) SetSites(sites []Site) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sites = append([]Site(nil), sites...)
+}
+
+func (r *Registry) Sites() []Site {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Site(nil), r.sites...)
+}
+
+func (r *Registry) Site(name string) (Site, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, site := range r.sites {
+		if site.Site == name {
+			return site, true
+		}
+	}
+	return Site{}, false
+}
+
+func (r *Registry) SetConfig(cfg Config) error {
+	entries, err := buildNotifiers(cfg)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = cfg
+	r.notifiers = entries
+	return nil
+}
+
+func (r *Registry) Config() Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+func (r *Registry) setNotifiers(entries []notifierEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifiers = entries
+}
+
+func (r *Registry) activeNotifiers() []notifierEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.notifiers
+}
+
+func (r *Registry) SetDryRun(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dryRun = enabled
+}
+
+func (r *Registry) DryRun() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dryRun || r.config.DryRun
+}
+
+func (r *Registry) SetProvinces(site string, country string, provinces []Province) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.provinces[provinceKey{site, strings.ToUpper(country)}] = append([]Province(nil), provinces...)
+}
+
+func (r *Registry) Provinces(site string, country string) ([]Province, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provinces, ok := r.provinces[provinceKey{site, strings.ToUpper(country)}]
+	return provinces, ok
+}
+
+func (r *Registry) Province(site string, country string, name string) (Province, error) {
+	provinces, ok := r.Provinces(site, country)
+	if !ok {
+		return Province{}, fmt.Errorf("provinces for %s in %s are not loaded", site, strings.ToUpper(country))
+	}
+	return matchProvince(provinces, name)
+}
+
+func (r *Registry) SetProfiles(store *ProfileStore) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profiles = store
+}
+
+func (r *Registry) ExpandProfile(name string) ([]Profile, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if profile := r.profiles.Find(name); profile != nil {
+		return []Profile{*profile}, true
+	}
+	members := r.profiles.Group(name)
+	return members, len(members) > 0
+}
+
+func (r *Registry) SetVault(v *Vault) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.vault = v
+}
+
+func (r *Registry) VaultUnlocked() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.vault != nil
+}
+
+func (r *Registry) Secret(name string) (VaultSecret, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.vault == nil {
+		return VaultSecret{}, false
+	}
+	secret, ok := r.vault.Secrets[name]
+	return secret, ok
+}
+
+func (r *Registry) updateVault(fn func(v *Vault) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.vault == nil {
+		return fmt.Errorf("the vault is locked or missing")
+	}
+	return fn(r.vault)
+}
+
+func (r *Registry) SetProxies(groups map[string][]Proxy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.proxies = groups
+	r.proxyNext = make(map[string]int)
+}
+
+func (r *Registry) HasProxyGroup(group string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.proxies[group]) > 0
+}
+
+func (r *Registry) Proxies() []Proxy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.proxies))
+	for name := range r.proxies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var proxies []Proxy
+	for _, name := range names {
+		proxies = append(proxies, r.proxies[name]...)
+	}
+	return proxies
+}
+
+func (r *Registry) NextProxy(group string) (Proxy, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	proxies := r.proxies[group]
+	if len(proxies) == 0 {
+		return Proxy{}, false
+	}
+	proxy := proxies[r.proxyNext[group]%len(proxies)]
+	r.proxyNext[group]++
+	return proxy, true
+}
+
+func (r *Registry) cachedShipping(key shippingKey, ttl time.Duration) (ShippingCheckout, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.shipping[key]
+	if !ok || time.Since(entry.at) > ttl {
+		return ShippingCheckout{}, false
+	}
+	return entry.checkout, true
+}
+
+func (r *Registry) storeShipping(key shippingKey, checkout ShippingCheckout) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shipping[key] = shippingCacheEntry{checkout: checkout, at: time.Now()}
+}
+
+func (r *Registry) forgetShipping(key shippingKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.shipping, key)
+}
+
+func (r *Registry) RecordScrapeTime(site string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scrapes[site] = d
+}
+
+func (r *Registry) ScrapeTime(site string) (time.Duration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.scrapes[site]
+	return d, ok
+}
+
+func (r *Registry) SetHistory(h *History) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.history = h
+}
+
+func (r *Registry) History() *History {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.history
+}
+
+func (r *Registry) setBoard(b *runBoard) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.board = b
+}
+
+func (r *Registry) currentBoard() *runBoard {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.board
+}
+
+func (r *Registry) DiscordQueue() *DiscordQueue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.discord == nil {
+		r.discord = NewDiscordQueue(&http.Client{Timeout: defaultRequestTimeout}, GetDeadLetterFile)
+	}
+	return r.discord
+}
+
+func (r *Registry) NotifyQueue() *NotifyQueue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.notify == nil {
+		r.notify = NewNotifyQueue()
+	}
+	return r.notify
+}
@@ -0,0 +1,246 @@
+package tasks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const reloadInterval = time.Second
+
+type watchedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func newWatchedFile(path string) *watchedFile {
+	w := &watchedFile{path: path}
+	w.changed()
+	return w
+}
+
+func (w *watchedFile) changed() bool {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return false
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+	return true
+}
+
+type taskKey string
+
+func (t Task) contentHash() string {
+	t.Row, t.ID, t.DryRun, t.Query, t.SizeSpec = 0, "", false, nil, nil
+	data, _ := json.Marshal(t)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (t Task) key() taskKey {
+	if t.ID != "" {
+		return taskKey("id:" + t.ID + "/" + t.Profile)
+	}
+	return taskKey("content:" + t.contentHash())
+}
+
+type taskRun struct {
+	mu       sync.Mutex
+	tasks    []Task
+	results  [][]taskResult
+	index    map[taskKey][]int
+	children map[int]bool
+}
+
+func newTaskRun(tasks []Task) *taskRun {
+	index := make(map[taskKey][]int, len(tasks))
+	for idx, task := range tasks {
+		index[task.key()] = append(index[task.key()], idx)
+	}
+	return &taskRun{tasks: tasks, results: make([][]taskResult, len(tasks)), index: index, children: make(map[int]bool)}
+}
+
+func (r *taskRun) claim(key taskKey, claimed map[int]bool) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, idx := range r.index[key] {
+		if !claimed[idx] {
+			claimed[idx] = true
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+func (r *taskRun) running(hash string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, task := range r.tasks {
+		if task.contentHash() == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *taskRun) task(idx int) Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tasks[idx]
+}
+
+func (r *taskRun) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.tasks) - len(r.children)
+}
+
+func (r *taskRun) add(board *runBoard, task Task, child bool) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx, ok := board.add(task)
+	if !ok {
+		return 0, false
+	}
+	if child {
+		r.children[idx] = true
+	} else {
+		r.index[task.key()] = append(r.index[task.key()], idx)
+	}
+	r.tasks = append(r.tasks, task)
+	r.results = append(r.results, nil)
+	return idx, true
+}
+
+func (r *taskRun) unclaimed(claimed map[int]bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for idx := range r.tasks {
+		if !r.children[idx] && !claimed[idx] {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *taskRun) replace(idx int, task Task) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if reflect.DeepEqual(r.tasks[idx], task) {
+		return false
+	}
+	r.tasks[idx] = task
+	return true
+}
+
+func (r *taskRun) setResults(idx int, results []taskResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[idx] = results
+}
+
+func (r *taskRun) allResults() [][]taskResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]taskResult(nil), r.results...)
+}
+
+type runWatcher struct {
+	files  Files
+	config *watchedFile
+	sites  *watchedFile
+	tasks  *watchedFile
+}
+
+func newRunWatcher(files Files) *runWatcher {
+	return &runWatcher{
+		files:  files,
+		config: newWatchedFile(files.Config),
+		sites:  newWatchedFile(files.Sites),
+		tasks:  newWatchedFile(files.Tasks),
+	}
+}
+
+func (w *runWatcher) watch(ctx context.Context, board *runBoard, run *taskRun, start func(int)) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-board.idle:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		if w.config.changed() {
+			if err := LoadConfig(w.files.Config); err != nil {
+				Logger().Warn("Config not reloaded, keeping the previous one", "err", err)
+			} else {
+				Logger().Info("Reloaded config", "file", w.files.Config)
+			}
+		}
+		if w.sites.changed() {
+			if err := LoadSites(w.files.Sites); err != nil {
+				Logger().Warn("Sites not reloaded, keeping the previous ones", "err", err)
+			} else {
+				Logger().Info("Reloaded sites", "file", w.files.Sites, "sites", len(ListSites()))
+			}
+		}
+		if w.tasks.changed() {
+			w.reloadTasks(board, run, start)
+		}
+	}
+}
+
+func (w *runWatcher) reloadTasks(board *runBoard, run *taskRun, start func(int)) {
+	loaded, err := LoadTasks(w.files.Tasks)
+	if err == nil {
+		err = ResolveProvinces(loaded)
+	}
+	if err != nil {
+		Logger().Warn("Tasks not reloaded, keeping the previous ones", "err", err)
+		return
+	}
+	mergeTasks(board, run, loaded, start)
+}
+
+func mergeTasks(board *runBoard, run *taskRun, loaded []Task, start func(int)) {
+	claimed := make(map[int]bool)
+	dryRun := dryRunEnabled()
+	for _, task := range loaded {
+		task.DryRun = task.DryRun || dryRun
+		if idx, ok := run.claim(task.key(), claimed); ok {
+			if run.replace(idx, task) {
+				taskLogger(idx, task.Site).Info("Task updated, changes apply when it restarts")
+			}
+			continue
+		}
+		if run.running(task.contentHash()) {
+			Logger().Warn("Task not started, an identical task is already running", "row", task.Row)
+			continue
+		}
+
+		added, ok := run.add(board, task, false)
+		if !ok {
+			return
+		}
+		claimed[added] = true
+		taskLogger(added, task.Site).Info("Task added")
+		start(added)
+	}
+	if removed := run.unclaimed(claimed); removed > 0 {
+		Logger().Warn("Tasks removed from the tasks file keep running until they finish", "removed", removed)
+	}
+}
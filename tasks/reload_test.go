@@ -0,0 +1,96 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+)
+
+func reloadTask(row int, keyword string) Task {
+	return Task{Row: row, Site: "peakkl", Keyword: keyword, Size: "M", Quantity: 1}
+}
+
+func TestMergeTasksIgnoresShiftedRows(t *testing.T) {
+	running := []Task{reloadTask(2, "cap"), reloadTask(3, "tee")}
+	board, run := newRunBoard(running), newTaskRun(running)
+
+	var started []int
+	mergeTasks(board, run, []Task{reloadTask(2, "hoodie"), reloadTask(3, "cap"), reloadTask(4, "tee")}, func(idx int) {
+		started = append(started, idx)
+	})
+
+	if len(started) != 1 || started[0] != 2 {
+		t.Fatalf("started %v, want only the inserted task 2", started)
+	}
+	for idx, want := range []string{"cap", "tee", "hoodie"} {
+		if got := run.task(idx).Keyword; got != want {
+			t.Errorf("task %d keyword = %q, want %q", idx, got, want)
+		}
+	}
+}
+
+func TestMergeTasksNeverStartsADuplicate(t *testing.T) {
+	running := []Task{reloadTask(2, "cap")}
+	board, run := newRunBoard(running), newTaskRun(running)
+
+	started := 0
+	mergeTasks(board, run, []Task{reloadTask(2, "cap"), reloadTask(3, "cap")}, func(int) { started++ })
+	if started != 0 || run.count() != 1 {
+		t.Fatalf("started %d tasks and run has %d, want 0 and 1", started, run.count())
+	}
+}
+
+func TestMergeTasksUpdatesByID(t *testing.T) {
+	first := reloadTask(2, "cap")
+	first.ID = "a"
+	board, run := newRunBoard([]Task{first}), newTaskRun([]Task{first})
+
+	edited := reloadTask(3, "tee")
+	edited.ID = "a"
+	started := 0
+	mergeTasks(board, run, []Task{reloadTask(2, "hoodie"), edited}, func(int) { started++ })
+
+	if started != 1 {
+		t.Fatalf("started %d tasks, want 1", started)
+	}
+	if got := run.task(0).Keyword; got != "tee" {
+		t.Errorf("task with id a keyword = %q, want %q", got, "tee")
+	}
+}
+
+func TestChildTasksGetTheirOwnRows(t *testing.T) {
+	parent := reloadTask(2, "cap")
+	parent.Select = SelectAll
+	board, run := newRunBoard([]Task{parent}), newTaskRun([]Task{parent})
+
+	var children []int
+	for _, productID := range []int{100, 200} {
+		pinned := parent
+		pinned.ProductID, pinned.Select = productID, SelectHighestID
+		child, ok := run.add(board, pinned, true)
+		if !ok {
+			t.Fatal("child task not added")
+		}
+		children = append(children, child)
+	}
+	if children[0] != 1 || children[1] != 2 || len(board.statuses) != 3 {
+		t.Fatalf("children = %v with %d board rows, want [1 2] and 3 rows", children, len(board.statuses))
+	}
+	if run.count() != 1 {
+		t.Errorf("run counts %d tasks, want only the parent", run.count())
+	}
+
+	started := 0
+	mergeTasks(board, run, []Task{parent}, func(int) { started++ })
+	if started != 0 || run.unclaimed(map[int]bool{0: true}) != 0 {
+		t.Errorf("reload started %d tasks or saw removed ones, want none", started)
+	}
+
+	board.controls[children[0]].restart <- struct{}{}
+	for _, child := range children {
+		board.begin(child, context.Background(), context.Background())
+		board.finish(child, false)
+	}
+	if board.active != 1 {
+		t.Errorf("board has %d active tasks after children finished, want 1", board.active)
+	}
+}
@@ -0,0 +1,175 @@
+package tasks
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SelectHighestID       = ""
+	SelectNewestPublished = "newest-published"
+	SelectNewestCreated   = "newest-created"
+	SelectLowestPrice     = "lowest-price"
+	SelectHighestPrice    = "highest-price"
+	SelectMostInventory   = "most-inventory"
+	SelectAll             = "all"
+)
+
+var selectStrategies = map[string]bool{
+	SelectHighestID:       true,
+	SelectNewestPublished: true,
+	SelectNewestCreated:   true,
+	SelectLowestPrice:     true,
+	SelectHighestPrice:    true,
+	SelectMostInventory:   true,
+	SelectAll:             true,
+}
+
+const productTimeLayout = "2006-01-02T15:04:05.000-07:00"
+
+func parseProductTime(value string) time.Time {
+	t, err := time.Parse(productTimeLayout, value)
+	if err != nil {
+		t, _ = time.Parse(time.RFC3339, value)
+	}
+	return t
+}
+
+func totalInventory(product Product) int {
+	total := 0
+	for _, variant := range product.Variants {
+		if variant.InventoryQuantity > 0 {
+			total += variant.InventoryQuantity
+		}
+	}
+	return total
+}
+
+func filterProducts(products []Product, task Task) []Product {
+	var matched []Product
+	for _, product := range products {
+		if task.ProductID != 0 && product.ID != task.ProductID {
+			continue
+		}
+		if task.Query != nil && !task.Query.Match(product.Name) {
+			continue
+		}
+		if task.MinPrice > 0 && product.Price < task.MinPrice {
+			continue
+		}
+		if task.MaxPrice > 0 && product.Price > task.MaxPrice {
+			continue
+		}
+		matched = append(matched, product)
+	}
+	return matched
+}
+
+func sortProducts(products []Product, strategy string) {
+	less := func(a, b Product) bool { return a.ID > b.ID }
+	switch strategy {
+	case SelectNewestPublished:
+		less = func(a, b Product) bool { return parseProductTime(a.PublishedAt).After(parseProductTime(b.PublishedAt)) }
+	case SelectNewestCreated:
+		less = func(a, b Product) bool { return parseProductTime(a.CreatedAt).After(parseProductTime(b.CreatedAt)) }
+	case SelectLowestPrice:
+		less = func(a, b Product) bool { return a.Price < b.Price }
+	case SelectHighestPrice:
+		less = func(a, b Product) bool { return a.Price > b.Price }
+	case SelectMostInventory:
+		less = func(a, b Product) bool { return totalInventory(a) > totalInventory(b) }
+	}
+
+	sort.SliceStable(products, func(i, j int) bool {
+		if less(products[i], products[j]) {
+			return true
+		}
+		if less(products[j], products[i]) {
+			return false
+		}
+		return products[i].ID > products[j].ID
+	})
+}
+
+func processAllMatches(monitorCtx context.Context, checkoutCtx context.Context, idx int, task Task, monitors *MonitorPool, board *runBoard, spawn func(Task) (int, bool)) []taskResult {
+	log := taskLogger(idx, task.Site)
+	productLink, err := GetProductLink(task.Site)
+	if err != nil {
+		log.Error("Failed to start task", "err", err)
+		updateStatus(idx, func(s *TaskStatus) {
+			s.State = StateFailed
+			s.LastError = err.Error()
+		})
+		return []taskResult{{State: StateFailed}}
+	}
+
+	subscription := monitors.Subscribe(task.Site, productLink, false, task.Proxy, time.Duration(task.Delay)*time.Millisecond)
+	var matched []Product
+	for {
+		var snapshot Snapshot
+		select {
+		case snapshot = <-subscription.C:
+		case <-monitorCtx.Done():
+			subscription.Close()
+			return []taskResult{{State: StateCanceled}}
+		}
+
+		if snapshot.Err != nil {
+			if snapshot.Transient {
+				continue
+			}
+			log.Error("Monitor failed", "err", snapshot.Err)
+			updateStatus(idx, func(s *TaskStatus) {
+				s.State = StateFailed
+				s.LastError = Redact(snapshot.Err.Error())
+			})
+			subscription.Close()
+			return []taskResult{{State: StateFailed}}
+		}
+
+		matched = filterProducts(snapshot.Collection.Products, task)
+		if len(matched) > 0 {
+			break
+		}
+		log.Info("No product matched / product not loaded")
+	}
+	subscription.Close()
+
+	log.Info("Products matched, starting one checkout each", "matched", len(matched))
+	results := make([]taskResult, len(matched))
+	var children []string
+	var wg sync.WaitGroup
+	for i, product := range matched {
+		pinned := task
+		pinned.ProductID = product.ID
+		pinned.Select = SelectHighestID
+
+		child, ok := spawn(pinned)
+		if !ok {
+			results[i] = taskResult{State: StateCanceled}
+			continue
+		}
+		log.Info("Checkout started for matched product", "product", product.Name, "checkout_task", child+1)
+		children = append(children, strconv.Itoa(child+1))
+
+		wg.Add(1)
+		go func(i int, child int, pinned Task) {
+			defer wg.Done()
+			childMonitorCtx, childCheckoutCtx, cancel := board.begin(child, monitorCtx, checkoutCtx)
+			results[i] = processTask(childMonitorCtx, childCheckoutCtx, child, pinned, monitors)
+			cancel()
+			board.finish(child, false)
+		}(i, child, pinned)
+	}
+	updateStatus(idx, func(s *TaskStatus) {
+		s.Product = "checkouts in tasks " + strings.Join(children, ", ")
+		s.State = StateDone
+	})
+	wg.Wait()
+
+	return results
+}
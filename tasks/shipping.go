@@ -0,0 +1,160 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ShippingCheapest = "cheapest"
+	ShippingFastest  = "fastest"
+)
+
+type shippingKey struct {
+	site     string
+	country  string
+	postcode string
+	province string
+}
+
+type shippingCacheEntry struct {
+	checkout ShippingCheckout
+	at       time.Time
+}
+
+func taskShippingKey(task Task) shippingKey {
+	return shippingKey{task.Site, task.Country, strings.ToUpper(strings.ReplaceAll(task.Zipcode, " ", "")), task.ProvinceCode}
+}
+
+func cachedShipping(key shippingKey) (*ShippingCheckout, bool) {
+	checkout, ok := registry.cachedShipping(key, GetShippingCacheTTL())
+	if !ok {
+		return nil, false
+	}
+	return &checkout, true
+}
+
+func storeShipping(key shippingKey, checkout *ShippingCheckout) {
+	registry.storeShipping(key, *checkout)
+}
+
+func forgetShipping(key shippingKey) {
+	registry.forgetShipping(key)
+}
+
+func (m ShippingMethod) PriceValue() (float64, bool) {
+	price, err := m.Price.Float64()
+	return price, err == nil && m.Price != ""
+}
+
+func (m ShippingMethod) speed() int {
+	switch {
+	case m.MaxDays > 0:
+		return m.MaxDays
+	case m.MinDays > 0:
+		return m.MinDays
+	default:
+		return math.MaxInt
+	}
+}
+
+func (m ShippingMethod) String() string {
+	s := fmt.Sprintf("%s (%s)", m.Title, m.Handle)
+	if price, ok := m.PriceValue(); ok {
+		s += fmt.Sprintf(" %.2f", price)
+	}
+	switch {
+	case m.MinDays > 0 && m.MaxDays > m.MinDays:
+		s += fmt.Sprintf(", %d-%d days", m.MinDays, m.MaxDays)
+	case m.speed() != math.MaxInt:
+		s += fmt.Sprintf(", %d days", m.speed())
+	}
+	return s
+}
+
+func describeMethods(methods []ShippingMethod) string {
+	descriptions := make([]string, len(methods))
+	for i, method := range methods {
+		descriptions[i] = method.String()
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+func cheaper(a ShippingMethod, b ShippingMethod) bool {
+	priceA, okA := a.PriceValue()
+	priceB, okB := b.PriceValue()
+	if okA != okB {
+		return okA
+	}
+	return priceA < priceB
+}
+
+func chooseShippingMethod(checkout *ShippingCheckout, selector string) (ShippingMethod, error) {
+	methods := checkout.ShippingMethods
+	if len(methods) == 0 && checkout.SelectedShippingMethod.Handle != "" {
+		methods = []ShippingMethod{checkout.SelectedShippingMethod}
+	}
+	if len(methods) == 0 {
+		return ShippingMethod{}, errors.New("store offered no shipping method for this address")
+	}
+
+	switch strings.ToLower(selector) {
+	case "":
+		if checkout.SelectedShippingMethod.Handle != "" {
+			return checkout.SelectedShippingMethod, nil
+		}
+		return methods[0], nil
+	case ShippingCheapest:
+		sorted := append([]ShippingMethod(nil), methods...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if cheaper(sorted[i], sorted[j]) {
+				return true
+			}
+			if cheaper(sorted[j], sorted[i]) {
+				return false
+			}
+			return sorted[i].speed() < sorted[j].speed()
+		})
+		return sorted[0], nil
+	case ShippingFastest:
+		sorted := append([]ShippingMethod(nil), methods...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if sorted[i].speed() != sorted[j].speed() {
+				return sorted[i].speed() < sorted[j].speed()
+			}
+			return cheaper(sorted[i], sorted[j])
+		})
+		return sorted[0], nil
+	}
+
+	for _, method := range methods {
+		if strings.EqualFold(method.Handle, selector) {
+			return method, nil
+		}
+	}
+	var matches []ShippingMethod
+	for _, method := range methods {
+		if strings.Contains(strings.ToLower(method.Title), strings.ToLower(selector)) {
+			matches = append(matches, method)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return ShippingMethod{}, fmt.Errorf("shipping method %q is not offered, available: %s", selector, describeMethods(methods))
+	default:
+		return ShippingMethod{}, fmt.Errorf("shipping method %q matches %d methods, available: %s", selector, len(matches), describeMethods(methods))
+	}
+}
+
+func isShippingUnavailable(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnprocessableEntity &&
+		strings.Contains(strings.ToLower(statusErr.Body), "shipping method")
+}
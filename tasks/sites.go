@@ -4,54 +4,71 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 )
 
 type Site struct {
-	Site            string `json:"site"`
-	Link            string `json:"link"`
-	ProductLink     string `json:"productlink"`
-	PaymentCategory string `json:"paymentCategory"`
-	GatewayHandle   string `json:"gatewayHandle"`
+	Site            string            `json:"site"`
+	Link            string            `json:"link"`
+	ProductLink     string            `json:"productlink"`
+	PaymentCategory string            `json:"paymentCategory"`
+	GatewayHandle   string            `json:"gatewayHandle"`
+	SizeAliases     map[string]string `json:"sizeAliases,omitempty"`
 }
 
-var sites []Site
-
-func LoadSites() error {
-	bytes, err := os.ReadFile("data/sites.json")
+func LoadSites(path string) error {
+	bytes, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("error opening sites.json file: %w", err)
+		return fmt.Errorf("error opening %s file: %w", path, err)
 	}
 
+	var sites []Site
 	if err := json.Unmarshal(bytes, &sites); err != nil {
-		return fmt.Errorf("error unmarshalling sites.json: %w", err)
+		return fmt.Errorf("error unmarshalling %s: %w", path, err)
 	}
 
+	registry.SetSites(sites)
 	return nil
 }
 
+func ListSites() []Site {
+	return registry.Sites()
+}
+
 func GetSiteLink(siteName string) (string, error) {
-	for _, site := range sites {
-		if site.Site == siteName {
-			return site.Link, nil
-		}
+	if site, ok := registry.Site(siteName); ok {
+		return site.Link, nil
 	}
 	return "", fmt.Errorf("site not found: %s", siteName)
 }
 
 func GetProductLink(siteName string) (string, error) {
-	for _, site := range sites {
-		if site.Site == siteName {
-			return site.ProductLink, nil
-		}
+	if site, ok := registry.Site(siteName); ok {
+		return site.ProductLink, nil
 	}
 	return "", fmt.Errorf("JSON Product endpoint not found: %s", siteName)
 }
 
 func GetPaymentGateway(siteName string) (string, string, error) {
-	for _, site := range sites {
-		if site.Site == siteName {
-			return site.PaymentCategory, site.GatewayHandle, nil
-		}
+	if site, ok := registry.Site(siteName); ok {
+		return site.PaymentCategory, site.GatewayHandle, nil
 	}
 	return "", "", fmt.Errorf("failed to fetch paymentgateway: %s", siteName)
 }
+
+func GetSite(siteName string) (*Site, error) {
+	if site, ok := registry.Site(siteName); ok {
+		return &site, nil
+	}
+	return nil, fmt.Errorf("site not found: %s", siteName)
+}
+
+func GetSizeAliases(siteName string) map[string]string {
+	aliases := make(map[string]string)
+	if site, ok := registry.Site(siteName); ok {
+		for alias, size := range site.SizeAliases {
+			aliases[strings.ToUpper(alias)] = strings.ToUpper(size)
+		}
+	}
+	return aliases
+}
@@ -0,0 +1,311 @@
+package tasks
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultSizeAliases = map[string]string{
+	"2XS":         "XXS",
+	"2XL":         "XXL",
+	"3XL":         "XXXL",
+	"EXTRA SMALL": "XS",
+	"SMALL":       "S",
+	"MEDIUM":      "M",
+	"LARGE":       "L",
+	"EXTRA LARGE": "XL",
+}
+
+var standardSizeOrder = []string{"XXXS", "XXS", "XS", "S", "M", "L", "XL", "XXL", "XXXL", "4XL", "5XL"}
+
+type sizeKind int
+
+const (
+	sizeRandom sizeKind = iota
+	sizeOptions
+	sizeRange
+	sizeSKU
+	sizeVariantID
+)
+
+type optionMatch struct {
+	name  string
+	value string
+}
+
+type sizeChoice struct {
+	kind      sizeKind
+	options   []optionMatch
+	from      string
+	to        string
+	sku       string
+	variantID int
+}
+
+type SizeSpec struct {
+	raw     string
+	choices []sizeChoice
+}
+
+func (s *SizeSpec) String() string {
+	return s.raw
+}
+
+func ParseSizeSpec(raw string) (*SizeSpec, error) {
+	spec := &SizeSpec{raw: raw}
+	for _, part := range strings.Split(raw, "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty size in %q", raw)
+		}
+
+		choice, err := parseSizeChoice(part)
+		if err != nil {
+			return nil, err
+		}
+		spec.choices = append(spec.choices, choice)
+	}
+	return spec, nil
+}
+
+func parseSizeChoice(part string) (sizeChoice, error) {
+	lower := strings.ToLower(part)
+	switch {
+	case strings.EqualFold(part, "RA"):
+		return sizeChoice{kind: sizeRandom}, nil
+	case strings.HasPrefix(lower, "sku:"):
+		sku := strings.TrimSpace(part[len("sku:"):])
+		if sku == "" {
+			return sizeChoice{}, fmt.Errorf("empty SKU in %q", part)
+		}
+		return sizeChoice{kind: sizeSKU, sku: sku}, nil
+	case strings.HasPrefix(lower, "id:"):
+		id, err := strconv.Atoi(strings.TrimSpace(part[len("id:"):]))
+		if err != nil || id <= 0 {
+			return sizeChoice{}, fmt.Errorf("invalid variant ID in %q", part)
+		}
+		return sizeChoice{kind: sizeVariantID, variantID: id}, nil
+	}
+
+	if from, to, ok := strings.Cut(part, "-"); ok && !strings.Contains(part, "/") && !strings.Contains(part, ":") {
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if rangeBound(from) && rangeBound(to) {
+			return sizeChoice{kind: sizeRange, from: from, to: to}, nil
+		}
+	}
+
+	choice := sizeChoice{kind: sizeOptions}
+	for _, value := range strings.Split(part, "/") {
+		value = strings.TrimSpace(value)
+		match := optionMatch{value: value}
+		if name, v, ok := strings.Cut(value, ":"); ok {
+			match = optionMatch{name: strings.TrimSpace(name), value: strings.TrimSpace(v)}
+		}
+		if match.value == "" {
+			return sizeChoice{}, fmt.Errorf("empty option value in %q", part)
+		}
+		choice.options = append(choice.options, match)
+	}
+	return choice, nil
+}
+
+func rangeBound(value string) bool {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return true
+	}
+	canonical := sizeMatcher{}.canonical(value)
+	for _, size := range standardSizeOrder {
+		if size == canonical {
+			return true
+		}
+	}
+	return false
+}
+
+type sizeMatcher struct {
+	product Product
+	aliases map[string]string
+}
+
+func (m sizeMatcher) canonical(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if alias, ok := m.aliases[value]; ok {
+		value = alias
+	}
+	if alias, ok := defaultSizeAliases[value]; ok {
+		value = alias
+	}
+	return value
+}
+
+func (m sizeMatcher) variantOptions(variant Variant) []string {
+	values := variant.Options
+	if len(values) == 0 {
+		for _, value := range []string{variant.Option1, variant.Option2, variant.Option3} {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	if len(values) == 0 {
+		values = strings.Split(variant.Title, " / ")
+	}
+	return values
+}
+
+func (m sizeMatcher) optionPosition(name string) int {
+	for _, option := range m.product.Options {
+		if strings.EqualFold(option.Name, name) {
+			return option.Position
+		}
+	}
+	return 0
+}
+
+func (m sizeMatcher) matchesOptions(variant Variant, options []optionMatch) bool {
+	if len(options) == 1 && options[0].name == "" && strings.EqualFold(variant.Title, options[0].value) {
+		return true
+	}
+
+	values := m.variantOptions(variant)
+	for _, option := range options {
+		if option.name != "" {
+			position := m.optionPosition(option.name)
+			if position < 1 || position > len(values) || m.canonical(values[position-1]) != m.canonical(option.value) {
+				return false
+			}
+			continue
+		}
+
+		found := false
+		for _, value := range values {
+			if m.canonical(value) == m.canonical(option.value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (m sizeMatcher) sizeOrder() []string {
+	for _, option := range m.product.Options {
+		name := strings.ToLower(option.Name)
+		if name == "size" || name == "saiz" {
+			order := make([]string, len(option.Values))
+			for i, value := range option.Values {
+				order[i] = m.canonical(value)
+			}
+			return order
+		}
+	}
+	return standardSizeOrder
+}
+
+func (m sizeMatcher) inRange(value string, from string, to string) bool {
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		lo, errLo := strconv.ParseFloat(from, 64)
+		hi, errHi := strconv.ParseFloat(to, 64)
+		if errLo == nil && errHi == nil {
+			return v >= lo && v <= hi
+		}
+	}
+
+	order := m.sizeOrder()
+	index := func(size string) int {
+		for i, s := range order {
+			if s == m.canonical(size) {
+				return i
+			}
+		}
+		return -1
+	}
+	lo, hi, v := index(from), index(to), index(value)
+	return lo >= 0 && hi >= 0 && v >= 0 && v >= lo && v <= hi
+}
+
+func (m sizeMatcher) rangeVariant(from string, to string) *Variant {
+	var best *Variant
+	bestIndex := -1
+	order := m.sizeOrder()
+	for i := range m.product.Variants {
+		variant := &m.product.Variants[i]
+		if !variant.Available {
+			continue
+		}
+		for _, value := range m.variantOptions(*variant) {
+			if !m.inRange(m.canonical(value), from, to) {
+				continue
+			}
+			index := len(order)
+			for j, s := range order {
+				if s == m.canonical(value) {
+					index = j
+					break
+				}
+			}
+			if best == nil || index < bestIndex {
+				best, bestIndex = variant, index
+			}
+			break
+		}
+	}
+	return best
+}
+
+func (m sizeMatcher) find(choice sizeChoice) *Variant {
+	switch choice.kind {
+	case sizeRandom:
+		var available []*Variant
+		for i := range m.product.Variants {
+			if m.product.Variants[i].Available {
+				available = append(available, &m.product.Variants[i])
+			}
+		}
+		if len(available) == 0 {
+			return nil
+		}
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		return available[r.Intn(len(available))]
+	case sizeRange:
+		return m.rangeVariant(choice.from, choice.to)
+	}
+
+	for i := range m.product.Variants {
+		variant := &m.product.Variants[i]
+		if !variant.Available {
+			continue
+		}
+		switch choice.kind {
+		case sizeSKU:
+			if strings.EqualFold(variant.SKU, choice.sku) {
+				return variant
+			}
+		case sizeVariantID:
+			if variant.ID == choice.variantID {
+				return variant
+			}
+		case sizeOptions:
+			if m.matchesOptions(*variant, choice.options) {
+				return variant
+			}
+		}
+	}
+	return nil
+}
+
+func findVariant(product Product, spec *SizeSpec, aliases map[string]string) (*Variant, error) {
+	matcher := sizeMatcher{product: product, aliases: aliases}
+	for _, choice := range spec.choices {
+		if variant := matcher.find(choice); variant != nil {
+			return variant, nil
+		}
+	}
+	return nil, fmt.Errorf("variant with size %s not found", spec)
+}
@@ -0,0 +1,131 @@
+package tasks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSizeSpec(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want []sizeChoice
+		ok   bool
+	}{
+		{"RA", []sizeChoice{{kind: sizeRandom}}, true},
+		{"M", []sizeChoice{{kind: sizeOptions, options: []optionMatch{{value: "M"}}}}, true},
+		{"M | L | RA", []sizeChoice{
+			{kind: sizeOptions, options: []optionMatch{{value: "M"}}},
+			{kind: sizeOptions, options: []optionMatch{{value: "L"}}},
+			{kind: sizeRandom},
+		}, true},
+		{"S-XL", []sizeChoice{{kind: sizeRange, from: "S", to: "XL"}}, true},
+		{"small - extra large", []sizeChoice{{kind: sizeRange, from: "small", to: "extra large"}}, true},
+		{"8.5-10", []sizeChoice{{kind: sizeRange, from: "8.5", to: "10"}}, true},
+		{"Black-White", []sizeChoice{{kind: sizeOptions, options: []optionMatch{{value: "Black-White"}}}}, true},
+		{"Free-Size", []sizeChoice{{kind: sizeOptions, options: []optionMatch{{value: "Free-Size"}}}}, true},
+		{"UK 8-10", []sizeChoice{{kind: sizeOptions, options: []optionMatch{{value: "UK 8-10"}}}}, true},
+		{"S-Black", []sizeChoice{{kind: sizeOptions, options: []optionMatch{{value: "S-Black"}}}}, true},
+		{"Black-White/XL", []sizeChoice{{kind: sizeOptions, options: []optionMatch{{value: "Black-White"}, {value: "XL"}}}}, true},
+		{"Color: Black / Size: M", []sizeChoice{{kind: sizeOptions, options: []optionMatch{{name: "Color", value: "Black"}, {name: "Size", value: "M"}}}}, true},
+		{"sku: PK-TEE-BLK-M", []sizeChoice{{kind: sizeSKU, sku: "PK-TEE-BLK-M"}}, true},
+		{"id:1004", []sizeChoice{{kind: sizeVariantID, variantID: 1004}}, true},
+		{"", nil, false},
+		{"M || L", nil, false},
+		{"sku:", nil, false},
+		{"id:abc", nil, false},
+		{"id:0", nil, false},
+		{"Black/", nil, false},
+		{"Size:", nil, false},
+	} {
+		spec, err := ParseSizeSpec(tc.raw)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseSizeSpec(%q) error = %v, want ok %v", tc.raw, err, tc.ok)
+			continue
+		}
+		if tc.ok && !reflect.DeepEqual(spec.choices, tc.want) {
+			t.Errorf("ParseSizeSpec(%q) = %+v, want %+v", tc.raw, spec.choices, tc.want)
+		}
+	}
+}
+
+var testApparel = Product{
+	Options: []ProductOption{
+		{Name: "Color", Position: 1, Values: []string{"Black", "White", "Black-White"}},
+		{Name: "Size", Position: 2, Values: []string{"S", "M", "L", "XL"}},
+	},
+	Variants: []Variant{
+		{ID: 1001, Title: "Black / S", SKU: "PK-TEE-BLK-S", Available: true, Options: []string{"Black", "S"}},
+		{ID: 1002, Title: "Black / M", SKU: "PK-TEE-BLK-M", Available: false, Options: []string{"Black", "M"}},
+		{ID: 1003, Title: "Black / L", SKU: "PK-TEE-BLK-L", Available: true, Options: []string{"Black", "L"}},
+		{ID: 1004, Title: "White / M", SKU: "PK-TEE-WHT-M", Available: true, Options: []string{"White", "M"}},
+		{ID: 1005, Title: "Black-White / XL", SKU: "PK-TEE-BW-XL", Available: true, Options: []string{"Black-White", "XL"}},
+	},
+}
+
+var testShoes = Product{
+	Options: []ProductOption{{Name: "Saiz", Position: 1, Values: []string{"7", "8", "8.5", "9", "10"}}},
+	Variants: []Variant{
+		{ID: 2001, Title: "7", Available: true, Option1: "7"},
+		{ID: 2002, Title: "8", Available: false, Option1: "8"},
+		{ID: 2003, Title: "8.5", Available: true, Option1: "8.5"},
+		{ID: 2004, Title: "9", Available: true, Option1: "9"},
+		{ID: 2005, Title: "10", Available: true, Option1: "10"},
+	},
+}
+
+func TestFindVariant(t *testing.T) {
+	for _, tc := range []struct {
+		product Product
+		spec    string
+		aliases map[string]string
+		want    int
+	}{
+		{testApparel, "S", nil, 1001},
+		{testApparel, "l", nil, 1003},
+		{testApparel, "Black / S", nil, 1001},
+		{testApparel, "M", nil, 1004},
+		{testApparel, "Black/M", nil, 0},
+		{testApparel, "Black/M | Black/L", nil, 1003},
+		{testApparel, "XXL | XL", nil, 1005},
+		{testApparel, "White/XL | RA", nil, -1},
+		{testApparel, "Color:White/Size:M", nil, 1004},
+		{testApparel, "Size:White", nil, 0},
+		{testApparel, "Black-White", nil, 1005},
+		{testApparel, "M-XL", nil, 1004},
+		{testApparel, "large - extra large", nil, 1003},
+		{testApparel, "XL-L", nil, 0},
+		{testApparel, "small", nil, 1001},
+		{testApparel, "Medium", map[string]string{"MEDIUM": "L"}, 1003},
+		{testApparel, "Kecil", map[string]string{"KECIL": "S"}, 1001},
+		{testApparel, "sku:pk-tee-wht-m", nil, 1004},
+		{testApparel, "sku:PK-TEE-BLK-M", nil, 0},
+		{testApparel, "id:1005", nil, 1005},
+		{testApparel, "id:1002", nil, 0},
+		{testShoes, "8", nil, 0},
+		{testShoes, "8-9", nil, 2003},
+		{testShoes, "9.5-12", nil, 2005},
+		{testShoes, "11-12", nil, 0},
+		{testShoes, "10 | 9", nil, 2005},
+	} {
+		spec, err := ParseSizeSpec(tc.spec)
+		if err != nil {
+			t.Errorf("ParseSizeSpec(%q) error: %v", tc.spec, err)
+			continue
+		}
+		variant, err := findVariant(tc.product, spec, tc.aliases)
+		switch {
+		case tc.want == 0:
+			if err == nil {
+				t.Errorf("findVariant(%q) = %d, want not found", tc.spec, variant.ID)
+			}
+		case err != nil:
+			t.Errorf("findVariant(%q) error: %v", tc.spec, err)
+		case tc.want == -1:
+			if !variant.Available {
+				t.Errorf("findVariant(%q) = %d, want an available variant", tc.spec, variant.ID)
+			}
+		case variant.ID != tc.want:
+			t.Errorf("findVariant(%q) = %d, want %d", tc.spec, variant.ID, tc.want)
+		}
+	}
+}
@@ -0,0 +1,563 @@
+package tasks
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ModeDefault = ""
+	ModeRestock = "restock"
+	ModeDryRun  = "dry-run"
+)
+
+type Task struct {
+	Row          int
+	ID           string
+	Mode         string
+	DryRun       bool
+	Proxy        string
+	Profile      string
+	Card         string
+	Site         string
+	Delay        int
+	Keyword      string
+	Query        *Query
+	VariantID    int
+	Select       string
+	MinPrice     float64
+	MaxPrice     float64
+	ProductID    int
+	Size         string
+	SizeSpec     *SizeSpec
+	Quantity     int
+	FirstName    string
+	LastName     string
+	Email        string
+	Phone        string
+	AddressLine1 string
+	AddressLine2 string
+	Zipcode      string
+	City         string
+	State        string
+	Country      string
+	ProvinceCode string
+	Delivery     string
+	Pickup       string
+	Slot         string
+	Receiver     Receiver
+	Shipping     string
+	CardNo       string
+	ExpiryDate   string
+	CVV          string
+}
+
+type TaskError struct {
+	Row    int
+	Column string
+	Msg    string
+}
+
+func (e *TaskError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Msg)
+	}
+	return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Msg)
+}
+
+type TaskErrors []*TaskError
+
+func (e TaskErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+var taskColumns = []string{"site", "delay", "keyword", "size", "quantity"}
+
+var optionalColumns = []string{
+	"id", "mode", "select", "min_price", "max_price", "proxy", "profile", "card", "country",
+	"delivery", "pickup", "slot", "shipping", "receiver_firstname", "receiver_lastname", "receiver_email", "receiver_phone",
+}
+
+var taskModes = map[string]bool{
+	ModeDefault: true,
+	ModeRestock: true,
+}
+
+var nullableColumns = map[string]bool{
+	"cardno":     true,
+	"expirydate": true,
+	"cvv":        true,
+}
+
+var (
+	emailRegex   = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	phoneRegex   = regexp.MustCompile(`^\+?[0-9]{9,15}$`)
+	countryRegex = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+var postcodeFormats = map[string]struct {
+	pattern *regexp.Regexp
+	example string
+}{
+	"MY": {regexp.MustCompile(`^[0-9]{5}$`), "56000"},
+	"SG": {regexp.MustCompile(`^[0-9]{6}$`), "238823"},
+	"BN": {regexp.MustCompile(`^[A-Z]{2}[0-9]{4}$`), "BS8811"},
+}
+
+func LoadTasks(path string) ([]Task, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer file.Close()
+
+	return ParseTasks(file)
+}
+
+func ParseTasks(r io.Reader) ([]Task, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	headers, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("tasks file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+
+	columnIndex := make(map[string]int)
+	for i, header := range headers {
+		columnIndex[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+
+	var errs TaskErrors
+	_, hasProfile := columnIndex["profile"]
+	_, hasCard := columnIndex["card"]
+	for _, column := range append(append([]string(nil), taskColumns...), profileColumns...) {
+		if hasCard && nullableColumns[column] {
+			continue
+		}
+		if _, ok := columnIndex[column]; !ok && (!hasProfile || isTaskColumn(column)) {
+			errs = append(errs, &TaskError{Row: 1, Column: column, Msg: "missing from header"})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	var tasks []Task
+	ids := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				errs = append(errs, &TaskError{Row: parseErr.StartLine, Msg: parseErr.Err.Error()})
+				continue
+			}
+			return nil, fmt.Errorf("error reading tasks: %w", err)
+		}
+
+		row, _ := reader.FieldPos(0)
+		rowTasks, rowErrs := parseRow(row, record, columnIndex)
+		if len(rowTasks) > 0 && rowTasks[0].ID != "" {
+			id := rowTasks[0].ID
+			if previous, ok := ids[id]; ok {
+				rowErrs = append(rowErrs, &TaskError{Row: row, Column: "id", Msg: fmt.Sprintf("%q is already used on row %d", id, previous)})
+			}
+			ids[id] = row
+		}
+		errs = append(errs, rowErrs...)
+		if len(rowErrs) == 0 {
+			tasks = append(tasks, rowTasks...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no tasks found")
+	}
+
+	return tasks, nil
+}
+
+func isTaskColumn(column string) bool {
+	for _, c := range taskColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRow(row int, record []string, columnIndex map[string]int) ([]Task, TaskErrors) {
+	var errs TaskErrors
+	values := make(map[string]string)
+	for _, column := range append(append([]string(nil), taskColumns...), profileColumns...) {
+		i, ok := columnIndex[column]
+		if !ok {
+			continue
+		}
+		if i >= len(record) {
+			errs = append(errs, &TaskError{Row: row, Column: column, Msg: fmt.Sprintf("missing (row has %d of %d columns)", len(record), len(columnIndex))})
+			continue
+		}
+		values[column] = strings.TrimSpace(record[i])
+	}
+	for _, column := range optionalColumns {
+		if i, ok := columnIndex[column]; ok && i < len(record) {
+			values[column] = strings.TrimSpace(record[i])
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	name := values["profile"]
+	if name == "" {
+		task, errs := parseTask(row, values)
+		return []Task{task}, errs
+	}
+
+	members, ok := expandProfile(name)
+	if !ok {
+		return nil, TaskErrors{{Row: row, Column: "profile", Msg: fmt.Sprintf("unknown profile or profile group %q", name)}}
+	}
+
+	var tasks []Task
+	for _, profile := range members {
+		merged := make(map[string]string, len(values))
+		for column, value := range values {
+			merged[column] = value
+		}
+		for column, value := range profile.values() {
+			if merged[column] == "" {
+				merged[column] = value
+			}
+		}
+		if secret, ok := lookupSecret(profile.Name); ok && merged["card"] == "" {
+			fillSecret(merged, secret)
+		}
+
+		task, profileErrs := parseTask(row, merged)
+		for _, err := range profileErrs {
+			err.Msg = fmt.Sprintf("%s (profile %s)", err.Msg, profile.Name)
+		}
+		errs = append(errs, profileErrs...)
+		task.Profile = profile.Name
+		tasks = append(tasks, task)
+	}
+	return tasks, errs
+}
+
+func parseTask(row int, values map[string]string) (Task, TaskErrors) {
+	var errs TaskErrors
+	fail := func(column string, format string, args ...interface{}) {
+		errs = append(errs, &TaskError{Row: row, Column: column, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if name := values["card"]; name != "" {
+		if secret, ok := lookupSecret(name); ok {
+			fillSecret(values, secret)
+		} else if VaultUnlocked() {
+			fail("card", "no card named %q in the vault", name)
+		} else {
+			fail("card", "references the vault, which is locked or missing")
+		}
+	}
+
+	for _, column := range append(append([]string(nil), taskColumns...), profileColumns...) {
+		if values[column] == "" && !nullableColumns[column] && column != "state" {
+			fail(column, "cannot be empty")
+			delete(values, column)
+		}
+	}
+
+	task := Task{
+		Row:          row,
+		ID:           values["id"],
+		Select:       strings.ToLower(values["select"]),
+		Proxy:        values["proxy"],
+		Card:         values["card"],
+		Site:         values["site"],
+		Keyword:      values["keyword"],
+		Size:         values["size"],
+		FirstName:    values["firstname"],
+		LastName:     values["lastname"],
+		Email:        values["email"],
+		Phone:        values["phone"],
+		AddressLine1: values["address_line1"],
+		AddressLine2: values["address_line2"],
+		Zipcode:      values["zipcode"],
+		City:         values["city"],
+		State:        values["state"],
+		CardNo:       values["cardno"],
+		ExpiryDate:   values["expirydate"],
+		CVV:          values["cvv"],
+	}
+
+	if v, ok := values["delay"]; ok {
+		delay, err := strconv.Atoi(v)
+		if err != nil || delay < 0 {
+			fail("delay", "%q is not a non-negative integer", v)
+		}
+		task.Delay = delay
+	}
+
+	if v, ok := values["quantity"]; ok {
+		quantity, err := strconv.Atoi(v)
+		if err != nil || quantity < 1 {
+			fail("quantity", "%q is not a positive integer", v)
+		}
+		task.Quantity = quantity
+	}
+
+	variantID, isVariant, err := parseVariantKeyword(task.Site, task.Keyword)
+	if err != nil {
+		fail("keyword", "%v", err)
+	}
+	task.VariantID = variantID
+
+	if task.Keyword != "" && !isVariant && !isDirectLink(task.Keyword) {
+		query, err := ParseQuery(task.Keyword)
+		if err != nil {
+			fail("keyword", "%v", err)
+		}
+		task.Query = query
+	}
+
+	if task.Size != "" {
+		spec, err := ParseSizeSpec(task.Size)
+		if err != nil {
+			fail("size", "%v", err)
+		}
+		task.SizeSpec = spec
+	}
+
+	if !selectStrategies[task.Select] {
+		fail("select", "unknown selection strategy %q", task.Select)
+	}
+	if task.Select == SelectAll && task.Query == nil {
+		fail("select", "%q needs a keyword query, not a product link", task.Select)
+	}
+
+	task.MinPrice = parsePrice(values, "min_price", fail)
+	task.MaxPrice = parsePrice(values, "max_price", fail)
+	if task.MinPrice > 0 && task.MaxPrice > 0 && task.MinPrice > task.MaxPrice {
+		fail("max_price", "%.2f is below min_price %.2f", task.MaxPrice, task.MinPrice)
+	}
+
+	for _, mode := range strings.Split(strings.ToLower(values["mode"]), "+") {
+		switch mode = strings.TrimSpace(mode); {
+		case mode == ModeDryRun:
+			task.DryRun = true
+		case !taskModes[mode]:
+			fail("mode", "unknown mode %q", mode)
+		case mode != ModeDefault:
+			task.Mode = mode
+		}
+	}
+	if task.Mode == ModeRestock && task.VariantID != 0 {
+		fail("mode", "%q needs a keyword query or product link, not a variant ID", task.Mode)
+	}
+
+	if task.Site != "" {
+		if _, err := GetSite(task.Site); err != nil {
+			fail("site", "unknown site %q", task.Site)
+		}
+	}
+
+	country, err := ParseCountry(values["country"])
+	if err != nil {
+		fail("country", "%v", err)
+	}
+	task.Country = country
+	if task.Zipcode != "" && err == nil {
+		if err := ValidatePostcode(task.Country, task.Zipcode); err != nil {
+			fail("zipcode", "%v", err)
+		}
+	}
+
+	task.Delivery = strings.ToLower(values["delivery"])
+	if task.Delivery == "" {
+		task.Delivery = DeliveryShipping
+	}
+	if _, ok := deliveryMethods[task.Delivery]; !ok {
+		fail("delivery", "unknown delivery mode %q", values["delivery"])
+	}
+	task.Pickup = values["pickup"]
+	task.Slot = values["slot"]
+	if task.Pickup != "" && task.Delivery != DeliverySelfCollect {
+		fail("pickup", "only applies to %s delivery", DeliverySelfCollect)
+	}
+	if task.Slot != "" && task.Delivery != DeliveryDelivery {
+		fail("slot", "only applies to %s delivery", DeliveryDelivery)
+	}
+	task.Shipping = values["shipping"]
+	if task.Shipping != "" && task.Delivery == DeliverySelfCollect {
+		fail("shipping", "does not apply to %s delivery", DeliverySelfCollect)
+	}
+	if task.Delivery == DeliverySelfCollect {
+		task.Receiver = Receiver{
+			FirstName: firstNonEmpty(values["receiver_firstname"], task.FirstName),
+			LastName:  firstNonEmpty(values["receiver_lastname"], task.LastName),
+			Email:     firstNonEmpty(values["receiver_email"], task.Email),
+			Phone:     firstNonEmpty(values["receiver_phone"], task.Phone),
+		}
+	}
+
+	if task.Proxy != "" && !HasProxyGroup(task.Proxy) {
+		fail("proxy", "unknown or empty proxy group %q", task.Proxy)
+	}
+
+	registerTaskSecrets(task)
+
+	if task.Email != "" {
+		if err := ValidateEmail(task.Email); err != nil {
+			fail("email", "%v", err)
+		}
+	}
+
+	if task.Phone != "" {
+		if err := ValidatePhone(task.Phone); err != nil {
+			fail("phone", "%v", err)
+		}
+	}
+
+	if v := values["receiver_email"]; v != "" {
+		if err := ValidateEmail(v); err != nil {
+			fail("receiver_email", "%v", err)
+		}
+	}
+
+	if v := values["receiver_phone"]; v != "" {
+		if err := ValidatePhone(v); err != nil {
+			fail("receiver_phone", "%v", err)
+		}
+	}
+
+	return task, errs
+}
+
+func ValidateEmail(email string) error {
+	if !emailRegex.MatchString(email) {
+		return fmt.Errorf("%q is not a valid email address", redactValue("email", email))
+	}
+	return nil
+}
+
+func ValidatePhone(phone string) error {
+	if !phoneRegex.MatchString(strings.NewReplacer(" ", "", "-", "").Replace(phone)) {
+		return fmt.Errorf("%q is not a valid phone number", redactValue("phone", phone))
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func ParseCountry(country string) (string, error) {
+	if country == "" {
+		return defaultCountry, nil
+	}
+	code := strings.ToUpper(strings.TrimSpace(country))
+	if !countryRegex.MatchString(code) {
+		return "", fmt.Errorf("%q is not a two-letter country code", country)
+	}
+	return code, nil
+}
+
+func ValidatePostcode(country string, postcode string) error {
+	format, ok := postcodeFormats[country]
+	if !ok {
+		return nil
+	}
+	if !format.pattern.MatchString(strings.ToUpper(strings.ReplaceAll(postcode, " ", ""))) {
+		return fmt.Errorf("%q is not a valid %s postcode (for example %s)", postcode, country, format.example)
+	}
+	return nil
+}
+
+func parsePrice(values map[string]string, column string, fail func(string, string, ...interface{})) float64 {
+	v := values[column]
+	if v == "" {
+		return 0
+	}
+	price, err := strconv.ParseFloat(v, 64)
+	if err != nil || price < 0 {
+		fail(column, "%q is not a valid price", v)
+		return 0
+	}
+	return price
+}
+
+func ResolveProvinces(tasks []Task) error {
+	var errs TaskErrors
+	var keyOrder []provinceKey
+	byKey := make(map[provinceKey][]*Task)
+	for i := range tasks {
+		key := provinceKey{tasks[i].Site, tasks[i].Country}
+		if _, ok := byKey[key]; !ok {
+			keyOrder = append(keyOrder, key)
+		}
+		byKey[key] = append(byKey[key], &tasks[i])
+	}
+
+	for _, key := range keyOrder {
+		err := LoadProvinces(key.site, key.country)
+		provinces, _ := registry.Provinces(key.site, key.country)
+
+		for _, task := range byKey[key] {
+			if err != nil {
+				errs = append(errs, &TaskError{Row: task.Row, Column: "state", Msg: fmt.Sprintf("error loading provinces: %v", err)})
+				continue
+			}
+			if len(provinces) == 0 {
+				task.ProvinceCode = ""
+				continue
+			}
+			if task.State == "" {
+				errs = append(errs, &TaskError{Row: task.Row, Column: "state", Msg: "cannot be empty"})
+				continue
+			}
+			province, matchErr := registry.Province(task.Site, task.Country, task.State)
+			if matchErr != nil {
+				errs = append(errs, &TaskError{Row: task.Row, Column: "state", Msg: matchErr.Error()})
+				continue
+			}
+			if province.Name != task.State {
+				Logger().Info("Matched state", "row", task.Row, "given", task.State, "province", province.Name, "code", province.Code)
+			}
+			task.ProvinceCode = province.Code
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Row < errs[j].Row })
+		return errs
+	}
+	return nil
+}
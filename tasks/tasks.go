@@ -1,50 +1,56 @@
 package tasks
 
 import (
-	"encoding/csv"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
-	"log"
-	"math/rand"
+	"log/slog"
 	"net/http"
-	"net/http/cookiejar"
-	"os"
 	"regexp"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 )
 
 type Variant struct {
-	ID                int    `json:"id"`
-	Title             string `json:"title"`
-	SKU               string `json:"sku"`
-	Available         bool   `json:"available"`
-	InventoryQuantity int    `json:"inventory_quantity"`
-	IsEnabled         bool   `json:"is_enabled"`
+	ID                int      `json:"id"`
+	Title             string   `json:"title"`
+	SKU               string   `json:"sku"`
+	Available         bool     `json:"available"`
+	InventoryQuantity int      `json:"inventory_quantity"`
+	IsEnabled         bool     `json:"is_enabled"`
+	Options           []string `json:"options"`
+	Option1           string   `json:"option1"`
+	Option2           string   `json:"option2"`
+	Option3           string   `json:"option3"`
+}
+
+type ProductOption struct {
+	Name     string   `json:"name"`
+	Position int      `json:"position"`
+	Values   []string `json:"values"`
 }
 
 type Product struct {
-	ID                              int       `json:"id"`
-	Handle                          string    `json:"handle"`
-	Name                            string    `json:"name"`
-	Title                           string    `json:"title"`
-	URL                             string    `json:"url"`
-	Price                           float64   `json:"price"`
-	Available                       bool      `json:"available"`
-	SoleVariantID                   int       `json:"sole_variant_id"`
-	Variants                        []Variant `json:"variants"`
-	SelectedVariant                 Variant   `json:"selected_variant"`
-	FirstAvailableVariant           Variant   `json:"first_available_variant"`
-	SelectedOrFirstAvailableVariant Variant   `json:"selected_or_first_available_variant"`
-	ImgURL                          string    `json:"img_url"`
-	PublishedAt                     string    `json:"published_at"`
-	CreatedAt                       string    `json:"created_at"`
+	ID                              int             `json:"id"`
+	Handle                          string          `json:"handle"`
+	Name                            string          `json:"name"`
+	Title                           string          `json:"title"`
+	URL                             string          `json:"url"`
+	Price                           float64         `json:"price"`
+	Available                       bool            `json:"available"`
+	SoleVariantID                   int             `json:"sole_variant_id"`
+	Variants                        []Variant       `json:"variants"`
+	SelectedVariant                 Variant         `json:"selected_variant"`
+	FirstAvailableVariant           Variant         `json:"first_available_variant"`
+	SelectedOrFirstAvailableVariant Variant         `json:"selected_or_first_available_variant"`
+	ImgURL                          string          `json:"img_url"`
+	PublishedAt                     string          `json:"published_at"`
+	CreatedAt                       string          `json:"created_at"`
+	Options                         []ProductOption `json:"options_with_values"`
 }
 
 type ProductDetail struct {
+	ID     int
 	Name   string
 	Price  float64
 	ImgUrl string
@@ -54,8 +60,13 @@ type Collection struct {
 	Products []Product `json:"products"`
 }
 
-func fetchHTML(url string, client *http.Client) (string, *http.Response, error) {
-	resp, err := client.Get(url)
+func fetchHTML(ctx context.Context, url string, client *http.Client) (string, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create GET request: %w", err)
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to fetch URL: %w", err)
 	}
@@ -90,141 +101,82 @@ func extractJavaScript(htmlContent string, isDirectLink bool) (string, error) {
 	return match[1], nil
 }
 
-func searchProducts(collection Collection, keywordQuery string) *Product {
-	var matchedProducts []Product
-
-	orConditions := strings.Split(keywordQuery, ",")
-
-	for _, product := range collection.Products {
-
-		productName := strings.ToLower(product.Name)
-		productMatches := false
-
-		for _, orCondition := range orConditions {
-			andConditions := strings.Split(orCondition, "&")
-			andMatches := true
-
-			for _, andCondition := range andConditions {
-				keyword := strings.TrimSpace(andCondition)
-				if !strings.Contains(productName, keyword) {
-					andMatches = false
-					break
-				}
-			}
-
-			if andMatches {
-				productMatches = true
-				break
-			}
-		}
-
-		if productMatches {
-			matchedProducts = append(matchedProducts, product)
-		}
-	}
-	if len(matchedProducts) > 0 {
-		highestIDProduct := matchedProducts[0]
-		for _, product := range matchedProducts {
-			if product.ID > highestIDProduct.ID {
-				highestIDProduct = product
-			}
-		}
-		return &highestIDProduct
+func searchProducts(collection Collection, task Task) *Product {
+	matchedProducts := filterProducts(collection.Products, task)
+	if len(matchedProducts) == 0 {
+		return nil
 	}
 
-	return nil
+	sortProducts(matchedProducts, task.Select)
+	return &matchedProducts[0]
 }
 
-func findVariant(product Product, size string) (*Variant, error) {
-	if size == "RA" {
-		var availableVariants []Variant
-		for _, variant := range product.Variants {
-			if variant.Available {
-				availableVariants = append(availableVariants, variant)
-			}
-		}
-		if len(availableVariants) == 0 {
-			return nil, fmt.Errorf("no available variants found for product %s", product.Name)
-		}
-
-		randSrc := rand.NewSource(time.Now().UnixNano())
-		r := rand.New(randSrc)
-
-		randomIndex := r.Intn(len(availableVariants))
-		selectedVariant := &availableVariants[randomIndex]
-		if selectedVariant.Available {
-			return selectedVariant, nil
-		}
-	}
-
-	for _, variant := range product.Variants {
-		if strings.EqualFold(variant.Title, size) && variant.Available {
-			return &variant, nil
-		}
-	}
-	return nil, fmt.Errorf("variant with size %s not found", size)
-}
-
-func handleDirectLink(task map[string]string, scriptContent string, idx int) (*Variant, []ProductDetail, error) {
-	var product Product
-	err := json.Unmarshal([]byte(scriptContent), &product)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to unmarshal JSON for site %s: %w", task["site"], err)
-	}
+func handleDirectLink(task Task, product Product, log *slog.Logger) (*Variant, []ProductDetail) {
 	if !product.Available {
-		fmt.Printf("[Task %d][OOS][%s] %s | Waiting For Restock\n", idx+1, task["site"], product.Name)
-		return nil, nil, nil
+		log.Info("Out of stock, waiting for restock", "product", product.Name)
+		return nil, nil
 	}
-	fmt.Printf("[Task %d][Product Found][%s] %s \n", idx+1, task["site"], product.Name)
-	variant, err := findVariant(product, task["size"])
+	log.Info("Product found", "product", product.Name)
+	variant, err := findVariant(product, task.SizeSpec, GetSizeAliases(task.Site))
 	if err != nil {
-		fmt.Printf("[Task %d][Variant OOS][%s] %s \n", idx+1, task["site"], product.Name)
-		return nil, nil, nil
+		log.Info("Variant out of stock", "product", product.Name, "err", err)
+		return nil, nil
 	}
-	fmt.Printf("[Task %d][Variant found][%s] %s \n", idx+1, task["site"], variant.Title)
+	log.Info("Variant found", "product", product.Name, "variant", variant.Title)
 
 	productDetail := ProductDetail{
+		ID:     product.ID,
 		Name:   product.Name,
 		Price:  product.Price,
 		ImgUrl: product.ImgURL,
 	}
 	productArray := []ProductDetail{productDetail}
-	return variant, productArray, nil
+	return variant, productArray
 }
 
-func handleKeywordMatching(task map[string]string, scriptContent string, idx int) (*Variant, []ProductDetail, error) {
-	var collection Collection
-	err := json.Unmarshal([]byte(scriptContent), &collection)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to unmarshal JSON for site %s: %w", task["site"], err)
-	}
-
-	keywords := task["keyword"]
-	matchedProduct := searchProducts(collection, keywords)
+func handleKeywordMatching(task Task, collection Collection, log *slog.Logger) (*Variant, []ProductDetail) {
+	matchedProduct := searchProducts(collection, task)
 	if matchedProduct == nil {
-		fmt.Printf("[Task %d][%s] No product matched / Product not loaded\n", idx+1, task["site"])
-		return nil, nil, nil
+		log.Info("No product matched / product not loaded")
+		return nil, nil
 	}
 	if !matchedProduct.Available {
-		fmt.Printf("[Task %d][OOS][%s] %s | Waiting For Restock\n", idx+1, task["site"], matchedProduct.Name)
-		return nil, nil, nil
+		log.Info("Out of stock, waiting for restock", "product", matchedProduct.Name)
+		return nil, nil
 	}
 
-	fmt.Printf("[Task %d][Product Found][%s] %s \n", idx+1, task["site"], matchedProduct.Name)
+	log.Info("Product found", "product", matchedProduct.Name)
 
-	variant, err := findVariant(*matchedProduct, task["size"])
+	variant, err := findVariant(*matchedProduct, task.SizeSpec, GetSizeAliases(task.Site))
 	if err != nil {
-		fmt.Printf("[Task %d][Variant OOS][%s] %s \n", idx+1, task["site"], matchedProduct.Name)
-		return nil, nil, nil
+		log.Info("Variant out of stock", "product", matchedProduct.Name, "err", err)
+		return nil, nil
 	}
-	fmt.Printf("[Task %d][Variant Found][%s] %s, Variant: %s \n", idx+1, task["site"], matchedProduct.Name, variant.Title)
+	log.Info("Variant found", "product", matchedProduct.Name, "variant", variant.Title)
 	productDetail := ProductDetail{
+		ID:     matchedProduct.ID,
 		Name:   matchedProduct.Name,
 		Price:  matchedProduct.Price,
 		ImgUrl: matchedProduct.ImgURL,
 	}
 	productArray := []ProductDetail{productDetail}
-	return variant, productArray, nil
+	return variant, productArray
+}
+
+func fetchXsrfToken(ctx context.Context, url string, client *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GET request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return extractXsrfToken(resp)
 }
 
 func extractXsrfToken(resp *http.Response) (string, error) {
@@ -236,197 +188,216 @@ func extractXsrfToken(resp *http.Response) (string, error) {
 	return "", fmt.Errorf("XSRF-TOKEN not found in cookies")
 }
 
-func processTask(idx int, task map[string]string, wg *sync.WaitGroup) {
-	defer wg.Done()
+type taskResult struct {
+	State        State
+	CheckoutLink string
+	DryRun       bool
+}
+
+func processTask(monitorCtx context.Context, checkoutCtx context.Context, idx int, task Task, monitors *MonitorPool) taskResult {
 	startTime := time.Now()
 
-	nullableFields := map[string]bool{
-		"cardno":     true,
-		"expirydate": true,
-		"cvv":        true,
+	c, err := newCheckout(monitorCtx, checkoutCtx, idx, task, monitors)
+	if err != nil {
+		taskLogger(idx, task.Site).Error("Failed to start checkout", "err", err)
+		updateStatus(idx, func(s *TaskStatus) {
+			s.State = StateFailed
+			s.LastError = Redact(err.Error())
+		})
+		return taskResult{State: StateFailed}
 	}
+	defer c.close()
 
-	validationFailed := false
-	for key, value := range task {
-		if !nullableFields[key] && value == "" {
-			fmt.Printf("Validation error: %s cannot be null in task: %v\n", key, task)
-			validationFailed = true
-			break
-		}
-	}
-	if validationFailed {
-		return
-	}
+	history := currentHistory()
+	c.checkoutID = history.startCheckout(idx, task)
+	state := c.run()
 
-	link, err := GetSiteLink(task["site"])
-	if err != nil {
-		fmt.Println(err)
-		return
+	duration := time.Since(startTime)
+	history.finishCheckout(c, state, duration)
+	log := c.log.With("state", state.String(), "elapsed", duration)
+	if task.VariantID != 0 && state == StateDone {
+		if saved, ok := c.timeSaved(); ok {
+			log = log.With("fast_mode_saved", saved)
+		}
 	}
+	log.Info("Task finished")
+	return taskResult{State: state, CheckoutLink: c.checkoutLink, DryRun: c.dryRun}
+}
 
-	discordWebhook := GetDiscordWebhook()
+type Files struct {
+	Tasks    string
+	Config   string
+	Sites    string
+	Proxies  string
+	Profiles string
+	Vault    string
+	History  string
+}
 
-	productlink, err := GetProductLink(task["site"])
-	if err != nil {
-		fmt.Println(err)
-		return
+func DefaultFiles() Files {
+	return Files{
+		Tasks:    "Tasks.csv",
+		Config:   "config.json",
+		Sites:    "data/sites.json",
+		Proxies:  "proxies.txt",
+		Profiles: "profiles.json",
+		Vault:    "vault.json",
+		History:  "history.db",
 	}
+}
 
-	paymentCategory, gatewayHandle, err := GetPaymentGateway(task["site"])
-	if err != nil {
-		fmt.Println(err)
-		return
+func PrepareTasks(files Files) ([]Task, error) {
+	if err := LoadSites(files.Sites); err != nil {
+		return nil, fmt.Errorf("error loading sites: %w", err)
 	}
 
-	provincesLink := fmt.Sprintf("%s/sf/countries/MY/provinces", link)
-	err = LoadProvinces(provincesLink)
-	if err != nil {
-		fmt.Println("Error loading provinces:", err)
-		return
+	if err := LoadConfig(files.Config); err != nil {
+		return nil, fmt.Errorf("error loading configuration: %w", err)
 	}
 
-	provinceCode, err := GetProvinceCode(task["state"])
-	if err != nil {
-		fmt.Println(err)
-		return
+	if err := LoadProxies(files.Proxies); err != nil {
+		return nil, fmt.Errorf("error loading proxies: %w", err)
 	}
 
-	task["state"] = provinceCode
+	if group := GetMonitorProxyGroup(""); group != "" && !HasProxyGroup(group) {
+		return nil, fmt.Errorf("MonitorProxyGroup %q is not a proxy group in %s", group, files.Proxies)
+	}
 
-	isDirectLink := strings.HasPrefix(task["keyword"], "https")
-	var htmlContent string
-	var resp *http.Response
-	var retryAttempts int
-	delay, err := strconv.Atoi(task["delay"])
-	if err != nil {
-		fmt.Printf("Delay Error: %v", err)
+	if err := LoadProfiles(files.Profiles); err != nil {
+		return nil, fmt.Errorf("error loading profiles: %w", err)
 	}
 
-	jar, err := cookiejar.New(nil)
+	tasks, err := LoadTasks(files.Tasks)
 	if err != nil {
-		fmt.Printf("Failed to create cookie jar: %v\n", err)
-		return
-	}
-	client := &http.Client{
-		Jar: jar,
+		return nil, fmt.Errorf("error loading tasks:\n%w", err)
 	}
 
-	for {
-		if isDirectLink {
-			htmlContent, resp, err = fetchHTML(task["keyword"], client)
-		} else {
-			htmlContent, resp, err = fetchHTML(productlink, client)
-		}
+	if err := ResolveProvinces(tasks); err != nil {
+		return nil, fmt.Errorf("error validating tasks:\n%w", err)
+	}
 
-		if err != nil {
-			if strings.Contains(err.Error(), "received non-200 response") {
-				fmt.Printf("[Task %d][%s]Product not loaded yet.\n", idx+1, task["site"])
-				time.Sleep(time.Duration(delay) * time.Millisecond)
-				continue
-			} else {
-				fmt.Printf("Failed to fetch HTML content for site %s: %v\n", task["site"], err)
-				break
-			}
-		}
+	return tasks, nil
+}
 
-		xsrfToken, err := extractXsrfToken(resp)
-		if err != nil {
-			fmt.Printf("Failed to extract XSRF token for site %s: %v\n", task["site"], err)
-			break
+func RunTasks(ctx context.Context, files Files) (int, error) {
+	setBoard(nil)
+	watcher := newRunWatcher(files)
+	tasks, err := PrepareTasks(files)
+	if err != nil {
+		return 0, err
+	}
+	if dryRunEnabled() {
+		for i := range tasks {
+			tasks[i].DryRun = true
 		}
+		Logger().Warn("Dry run: tasks stop before order placement, no orders will be created")
+	}
 
-		scriptContent, err := extractJavaScript(htmlContent, isDirectLink)
-		if err != nil {
-			fmt.Printf("Failed to find JavaScript object for site %s: %v\n", task["site"], err)
-			break
+	history, err := OpenHistory(files.History)
+	if err == nil {
+		if err = history.StartRun(files.Tasks, len(tasks)); err != nil {
+			history.Close()
 		}
+	}
+	if err != nil {
+		Logger().Warn("Not recording this run in history", "err", err)
+	} else {
+		setHistory(history)
+		defer func() {
+			setHistory(nil)
+			history.Close()
+		}()
+	}
+
+	checkoutCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+	finished := make(chan struct{})
+	go waitForShutdown(ctx, finished, abort)
+
+	run := newTaskRun(tasks)
+	monitors := NewMonitorPool()
+	board := newRunBoard(tasks)
+	setBoard(board)
+	var wg sync.WaitGroup
 
-		var variant *Variant
-		var productDetail []ProductDetail
-		if isDirectLink {
-			variant, productDetail, err = handleDirectLink(task, scriptContent, idx)
-		} else {
-			variant, productDetail, err = handleKeywordMatching(task, scriptContent, idx)
-		}
+	start := func(idx int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task := run.task(idx)
+				taskMonitorCtx, taskCheckoutCtx, cancel := board.begin(idx, ctx, checkoutCtx)
+				if task.Select == SelectAll {
+					spawn := func(pinned Task) (int, bool) { return run.add(board, pinned, true) }
+					run.setResults(idx, processAllMatches(taskMonitorCtx, taskCheckoutCtx, idx, task, monitors, board, spawn))
+				} else {
+					run.setResults(idx, []taskResult{processTask(taskMonitorCtx, taskCheckoutCtx, idx, task, monitors)})
+				}
+				cancel()
+				board.end(idx)
 
-		if err != nil {
-			fmt.Println(err)
-			break
-		}
-		if variant != nil {
-			cartToken, err := addToCart(link, variant.ID, task["quantity"], xsrfToken, client, idx)
-			if err != nil {
-				fmt.Printf("Failed to add variant to cart for site %s: %v\n", task["site"], err)
-			}
-			shippingRate, err := getShippingRate(idx, link, client, cartToken, task["address_line1"], task["zipcode"], task["city"], provinceCode, xsrfToken)
-			if err != nil {
-				fmt.Printf("Failed to get shipping rate: %v \n", err)
+				if !board.awaitRestart(ctx, idx) {
+					return
+				}
+				taskLogger(idx, task.Site).Info("Restarting task")
 			}
-
-			checkout, err := getCheckoutLink(link, client, cartToken, xsrfToken, shippingRate, task["firstname"], task["lastname"], task["email"], task["phone"], task["address_line1"], task["address_line2"], task["zipcode"], task["city"], provinceCode, paymentCategory, gatewayHandle)
-			if err != nil {
-				fmt.Printf("[Task %d][Checkout Failed] \n", idx+1)
+		}()
+	}
+	for idx := range tasks {
+		start(idx)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		watcher.watch(ctx, board, run, start)
+	}()
+	wg.Wait()
+	close(finished)
+
+	checkouts, dryRuns := 0, 0
+	states := make(map[State]int)
+	for _, taskResults := range run.allResults() {
+		for _, result := range taskResults {
+			states[result.State]++
+			if result.CheckoutLink != "" {
+				checkouts++
 			}
-
-			for _, detail := range productDetail {
-				fmt.Printf("[Task %d][Checkout Success] Product: %s | Variant: %s | Checkout Link: %v\n", idx+1, detail.Name, variant.Title, checkout)
-				if checkout == "" {
-					fmt.Printf("[Task %d][Checkout Failed] OOS On Checkout | Product: %s | Variant: %s", idx+1, detail.Name, variant.Title)
-				}
-				err := postToDiscord(idx, detail.Name, variant.Title, detail.Price, detail.ImgUrl, checkout, discordWebhook)
-				if err != nil {
-					fmt.Printf("[Task %d][Post Webhook Failed] %v", idx+1, err)
-				}
+			if result.DryRun && result.State == StateDone {
+				dryRuns++
 			}
-			break
 		}
-
-		retryAttempts++
-		time.Sleep(time.Duration(delay) * time.Millisecond)
 	}
-
-	duration := time.Since(startTime)
-	fmt.Printf("[Task %d]Execution time: %s, Site: %s\n", idx+1, duration, task["site"])
-}
-
-func RunTasks() {
-	err := LoadSites()
-	if err != nil {
-		fmt.Println("Error loading sites:", err)
-		return
+	if ctx.Err() != nil {
+		Logger().Warn("Tasks interrupted", "done", states[StateDone], "failed", states[StateFailed], "canceled", states[StateCanceled])
 	}
-
-	err = LoadConfig()
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
-		return
+	if dryRuns > 0 {
+		Logger().Info("Tasks finished", "checkouts", checkouts, "dry_runs", dryRuns, "tasks", run.count())
+	} else {
+		Logger().Info("Tasks finished", "checkouts", checkouts, "tasks", run.count())
 	}
-
-	file, err := os.Open("Tasks.csv")
-	if err != nil {
-		fmt.Println("Error opening CSV file:", err)
-		return
+	if history := currentHistory(); history != nil {
+		if err := history.FinishRun(checkouts, ctx.Err() != nil); err != nil {
+			Logger().Warn("Failed to record run in history", "err", err)
+		}
 	}
-	defer file.Close()
+	FlushNotifications()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		fmt.Println("Error reading CSV file:", err)
+	return checkouts + dryRuns, nil
+}
+
+func waitForShutdown(ctx context.Context, finished <-chan struct{}, abort context.CancelFunc) {
+	select {
+	case <-ctx.Done():
+	case <-finished:
 		return
 	}
 
-	headers := records[0]
-
-	var wg sync.WaitGroup
-
-	for idx, record := range records[1:] {
-		task := make(map[string]string)
-		for i, header := range headers {
-			task[header] = record[i]
-		}
-		wg.Add(1)
-		go processTask(idx, task, &wg)
+	grace := GetShutdownGrace()
+	Logger().Warn("Stopping monitors, waiting for in-flight checkouts", "grace", grace)
+	select {
+	case <-time.After(grace):
+		Logger().Warn("Grace period over, aborting remaining checkouts")
+		abort()
+	case <-finished:
 	}
-	wg.Wait()
 }
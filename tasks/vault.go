@@ -0,0 +1,367 @@
+package tasks
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	vaultVersion = 1
+	vaultKDF     = "argon2id"
+)
+
+var ErrWrongPassphrase = errors.New("wrong vault passphrase or corrupted vault")
+
+type VaultSecret struct {
+	CardNo     string `json:"cardno"`
+	ExpiryDate string `json:"expirydate"`
+	CVV        string `json:"cvv"`
+}
+
+func (s VaultSecret) empty() bool {
+	return s.CardNo == "" && s.ExpiryDate == "" && s.CVV == ""
+}
+
+type vaultFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+type Vault struct {
+	path    string
+	header  vaultFile
+	key     []byte
+	Secrets map[string]VaultSecret
+}
+
+func VaultExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func deriveKey(passphrase string, header vaultFile) []byte {
+	return argon2.IDKey([]byte(passphrase), header.Salt, header.Time, header.Memory, header.Threads, 32)
+}
+
+func CreateVault(path string, passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, errors.New("vault passphrase cannot be empty")
+	}
+
+	header := vaultFile{Version: vaultVersion, KDF: vaultKDF, Time: 3, Memory: 64 * 1024, Threads: 4, Salt: make([]byte, 16)}
+	if _, err := rand.Read(header.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return &Vault{path: path, header: header, key: deriveKey(passphrase, header), Secrets: make(map[string]VaultSecret)}, nil
+}
+
+func OpenVault(path string, passphrase string) (*Vault, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s file: %w", path, err)
+	}
+
+	var header vaultFile
+	if err := json.Unmarshal(bytes, &header); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %s: %w", path, err)
+	}
+	if header.Version != vaultVersion || header.KDF != vaultKDF {
+		return nil, fmt.Errorf("unsupported vault %s (version %d, kdf %s)", path, header.Version, header.KDF)
+	}
+
+	key := deriveKey(passphrase, header)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, header.Nonce, header.Data, header.Salt)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	v := &Vault{path: path, header: header, key: key, Secrets: make(map[string]VaultSecret)}
+	if err := json.Unmarshal(plaintext, &v.Secrets); err != nil {
+		return nil, fmt.Errorf("error reading vault contents: %w", err)
+	}
+	return v, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func (v *Vault) Save() error {
+	plaintext, err := json.Marshal(v.Secrets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault contents: %w", err)
+	}
+
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return err
+	}
+	header := v.header
+	header.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(header.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	header.Data = gcm.Seal(nil, header.Nonce, plaintext, header.Salt)
+
+	bytes, err := json.MarshalIndent(header, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault: %w", err)
+	}
+
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0o600); err != nil {
+		return fmt.Errorf("error writing %s: %w", v.path, err)
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		return fmt.Errorf("error writing %s: %w", v.path, err)
+	}
+	v.header = header
+	return nil
+}
+
+func (v *Vault) Names() []string {
+	names := make([]string, 0, len(v.Secrets))
+	for name := range v.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func UnlockVault(path string, passphrase string) error {
+	v, err := OpenVault(path, passphrase)
+	if err != nil {
+		return err
+	}
+	SetVault(v)
+	return nil
+}
+
+func SetVault(v *Vault) {
+	registry.SetVault(v)
+	if v != nil {
+		for _, secret := range v.Secrets {
+			registerVaultSecret(secret)
+		}
+	}
+}
+
+func VaultUnlocked() bool {
+	return registry.VaultUnlocked()
+}
+
+func lookupSecret(name string) (VaultSecret, bool) {
+	return registry.Secret(name)
+}
+
+func fillSecret(values map[string]string, secret VaultSecret) {
+	if values["cardno"] == "" && values["expirydate"] == "" && values["cvv"] == "" {
+		values["cardno"] = secret.CardNo
+		values["expirydate"] = secret.ExpiryDate
+		values["cvv"] = secret.CVV
+	}
+}
+
+func (v *Vault) MoveProfileSecrets(store *ProfileStore) int {
+	moved := 0
+	for i := range store.Profiles {
+		profile := &store.Profiles[i]
+		secret := profile.secret()
+		if secret.empty() {
+			continue
+		}
+		v.Secrets[profile.Name] = secret
+		profile.CardNo, profile.ExpiryDate, profile.CVV = "", "", ""
+		moved++
+	}
+	return moved
+}
+
+func StoreProfileSecrets(store *ProfileStore) (int, error) {
+	if !store.HasSecrets() {
+		return 0, nil
+	}
+
+	if !registry.VaultUnlocked() {
+		return 0, errors.New("card details are only saved to the vault, which is locked or missing")
+	}
+
+	moved := 0
+	err := registry.updateVault(func(v *Vault) error {
+		moved = v.MoveProfileSecrets(store)
+		if err := v.Save(); err != nil {
+			return err
+		}
+		for _, secret := range v.Secrets {
+			registerVaultSecret(secret)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+func VaultCard(name string) (string, bool) {
+	secret, ok := lookupSecret(name)
+	if !ok || secret.CardNo == "" {
+		return "", false
+	}
+	return RedactCard(secret.CardNo), true
+}
+
+func (v *Vault) secretName(secret VaultSecret) string {
+	for name, existing := range v.Secrets {
+		if existing == secret && strings.HasPrefix(name, "card-") {
+			return name
+		}
+	}
+
+	base := "card"
+	if len(secret.CardNo) >= 4 {
+		base = "card-" + secret.CardNo[len(secret.CardNo)-4:]
+	}
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := v.Secrets[name]; !ok {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+func (v *Vault) MoveTaskSecrets(r io.Reader, w io.Writer) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("error reading tasks: %w", err)
+	}
+	if len(records) == 0 {
+		return 0, fmt.Errorf("tasks file is empty")
+	}
+
+	columnIndex := make(map[string]int)
+	for i, header := range records[0] {
+		columnIndex[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	cardIndex, ok := columnIndex["card"]
+	if !ok {
+		cardIndex = len(records[0])
+		records[0] = append(records[0], "card")
+	}
+
+	get := func(record []string, column string) string {
+		if i, ok := columnIndex[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	moved := 0
+	for row, record := range records[1:] {
+		for len(record) <= cardIndex {
+			record = append(record, "")
+		}
+		records[row+1] = record
+
+		secret := VaultSecret{CardNo: get(record, "cardno"), ExpiryDate: get(record, "expirydate"), CVV: get(record, "cvv")}
+		if secret.empty() {
+			continue
+		}
+
+		name := v.secretName(secret)
+		v.Secrets[name] = secret
+		record[cardIndex] = name
+		for _, column := range []string{"cardno", "expirydate", "cvv"} {
+			if i, ok := columnIndex[column]; ok && i < len(record) {
+				record[i] = ""
+			}
+		}
+		moved++
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		return 0, fmt.Errorf("error writing tasks: %w", err)
+	}
+	return moved, nil
+}
+
+func ImportSecrets(files Files, passphrase string) error {
+	var v *Vault
+	var err error
+	if VaultExists(files.Vault) {
+		v, err = OpenVault(files.Vault, passphrase)
+	} else {
+		v, err = CreateVault(files.Vault, passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	var tasksOut strings.Builder
+	tasksFile, err := os.Open(files.Tasks)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", files.Tasks, err)
+	}
+	movedTasks, err := v.MoveTaskSecrets(tasksFile, &tasksOut)
+	tasksFile.Close()
+	if err != nil {
+		return err
+	}
+
+	store, err := ReadProfiles(files.Profiles)
+	if err != nil {
+		return err
+	}
+	movedProfiles := v.MoveProfileSecrets(store)
+
+	if err := v.Save(); err != nil {
+		return err
+	}
+	if movedTasks > 0 {
+		tmp := files.Tasks + ".tmp"
+		if err := os.WriteFile(tmp, []byte(tasksOut.String()), 0o600); err != nil {
+			return fmt.Errorf("error writing %s: %w", files.Tasks, err)
+		}
+		if err := os.Rename(tmp, files.Tasks); err != nil {
+			return fmt.Errorf("error writing %s: %w", files.Tasks, err)
+		}
+	}
+	if movedProfiles > 0 {
+		if err := WriteProfiles(files.Profiles, store); err != nil {
+			return err
+		}
+	}
+
+	Logger().Info("Moved card details into the vault", "tasks", movedTasks, "profiles", movedProfiles, "vault", files.Vault)
+	return nil
+}
@@ -0,0 +1,137 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	v, err := CreateVault(path, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := VaultSecret{CardNo: "4111111111111111", ExpiryDate: "10/29", CVV: "123"}
+	v.Secrets["card-1111"] = secret
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := OpenVault(path, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := opened.Secrets["card-1111"]; got != secret {
+		t.Errorf("opened secret = %+v, want %+v", got, secret)
+	}
+
+	opened.Secrets["card-2222"] = VaultSecret{CardNo: "5555555555552222"}
+	if err := opened.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenVault(path, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := strings.Join(reopened.Names(), ","); names != "card-1111,card-2222" {
+		t.Errorf("names after second save = %s", names)
+	}
+}
+
+func TestOpenVaultWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	v, err := CreateVault(path, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenVault(path, "hunter3"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("OpenVault with the wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestOpenVaultTamperedData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	v, err := CreateVault(path, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Secrets["card-1111"] = VaultSecret{CardNo: "4111111111111111"}
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header vaultFile
+	if err := json.Unmarshal(bytes, &header); err != nil {
+		t.Fatal(err)
+	}
+	header.Data[0] ^= 0xff
+	bytes, err = json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, bytes, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenVault(path, "hunter2"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("OpenVault on tampered data = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestMoveTaskSecrets(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		in    string
+		moved int
+		want  string
+	}{
+		{
+			name:  "without card column",
+			in:    "site,keyword,cardno,expirydate,cvv\npeakkl,dunk,4111111111111111,10/29,123\npeakkl,jordan,,,\n",
+			moved: 1,
+			want:  "site,keyword,cardno,expirydate,cvv,card\npeakkl,dunk,,,,card-1111\npeakkl,jordan,,,,\n",
+		},
+		{
+			name:  "with card column",
+			in:    "site,card,keyword,cardno,expirydate,cvv\npeakkl,,dunk,4111111111111111,10/29,123\npeakkl,work,jordan,,,\n",
+			moved: 1,
+			want:  "site,card,keyword,cardno,expirydate,cvv\npeakkl,card-1111,dunk,,,\npeakkl,work,jordan,,,\n",
+		},
+		{
+			name:  "ragged rows",
+			in:    "site,keyword,cardno,expirydate,cvv\npeakkl,dunk\npeakkl,jordan,5555555555552222,01/30\n",
+			moved: 1,
+			want:  "site,keyword,cardno,expirydate,cvv,card\npeakkl,dunk,,,,\npeakkl,jordan,,,,card-2222\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := &Vault{Secrets: make(map[string]VaultSecret)}
+			var out strings.Builder
+			moved, err := v.MoveTaskSecrets(strings.NewReader(tc.in), &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved != tc.moved {
+				t.Errorf("moved = %d, want %d", moved, tc.moved)
+			}
+			if out.String() != tc.want {
+				t.Errorf("tasks =\n%s\nwant\n%s", out.String(), tc.want)
+			}
+			if len(v.Secrets) != tc.moved {
+				t.Errorf("vault has %d secrets, want %d", len(v.Secrets), tc.moved)
+			}
+		})
+	}
+}
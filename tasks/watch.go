@@ -0,0 +1,74 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func WatchSites(ctx context.Context, files Files, siteNames []string, delay time.Duration) error {
+	if err := LoadSites(files.Sites); err != nil {
+		return fmt.Errorf("error loading sites: %w", err)
+	}
+
+	if err := LoadConfig(files.Config); err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+
+	if err := LoadProxies(files.Proxies); err != nil {
+		return fmt.Errorf("error loading proxies: %w", err)
+	}
+	if group := GetMonitorProxyGroup(""); group != "" && !HasProxyGroup(group) {
+		return fmt.Errorf("MonitorProxyGroup %q is not a proxy group in %s", group, files.Proxies)
+	}
+
+	var watched []Site
+	if len(siteNames) == 0 {
+		watched = ListSites()
+	}
+	for _, name := range siteNames {
+		site, err := GetSite(name)
+		if err != nil {
+			return err
+		}
+		watched = append(watched, *site)
+	}
+
+	monitors := NewMonitorPool()
+	events := make(chan StockEvent)
+	for _, site := range watched {
+		subscription := monitors.Subscribe(site.Site, site.ProductLink, false, "", delay)
+		defer subscription.Close()
+		go func() {
+			for {
+				select {
+				case snapshot := <-subscription.C:
+					for _, event := range snapshot.Events {
+						select {
+						case events <- event:
+						case <-ctx.Done():
+							return
+						}
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	Logger().Info("Monitoring sites for restocks", "sites", len(watched))
+	for {
+		var event StockEvent
+		select {
+		case event = <-events:
+		case <-ctx.Done():
+			Logger().Info("Stopped monitoring restocks")
+			FlushNotifications()
+			return nil
+		}
+
+		Logger().Info(event.String(), "site", event.Site, "event", event.Kind.String())
+		notify(stockNotification(event))
+	}
+}